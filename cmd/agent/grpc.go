@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/grpcserver"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	pb "github.com/Nchezhegova/metrics-alerts/internal/proto"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+// grpcTimeout limits one batch sent over gRPC
+const grpcTimeout = 10 * time.Second
+
+// toProto converts the metric to the gRPC message
+func toProto(m storage.Metrics) *pb.Metric {
+	res := &pb.Metric{Id: m.ID, Labels: m.Labels}
+	switch m.MType {
+	case config.Gauge:
+		res.Type = pb.Metric_GAUGE
+		if m.Value != nil {
+			res.Value = *m.Value
+		}
+	case config.Counter:
+		res.Type = pb.Metric_COUNTER
+		if m.Delta != nil {
+			res.Delta = *m.Delta
+		}
+	}
+	return res
+}
+
+// streamMetrics sends the metrics in one client stream, signed with the hash key when it is set
+func streamMetrics(client pb.MetricsClient, metrics []storage.Metrics, hashKey string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), grpcTimeout)
+	defer cancel()
+	if source != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, storage.SourceHeader, source)
+	}
+	msgs := make([]proto.Message, 0, len(metrics))
+	for _, m := range metrics {
+		msgs = append(msgs, toProto(m))
+	}
+	if hashKey != "" {
+		hash, err := helpers.CalculateMessagesHash(hashKey, msgs...)
+		if err != nil {
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, grpcserver.HashHeader, base64.StdEncoding.EncodeToString(hash))
+	}
+
+	stream, err := client.UpdateMetricsStream(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if err = stream.SendMsg(m); err != nil {
+			return err
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// sendGRPCMetrics sends the metrics over gRPC with retries
+func sendGRPCMetrics(client pb.MetricsClient, metrics []storage.Metrics, hashKey string) {
+	var err error
+	for i := 0; i < config.MaxRetries; i++ {
+		err = streamMetrics(client, metrics, hashKey)
+		if err == nil {
+			return
+		}
+		time.Sleep(RetryDelays[i])
+	}
+	log.Logger.Info("Max retries", zap.Error(err))
+}
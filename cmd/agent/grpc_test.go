@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/grpcserver"
+	pb "github.com/Nchezhegova/metrics-alerts/internal/proto"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+)
+
+func TestStreamMetrics(t *testing.T) {
+	m := &storage.MemStorage{}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	pb.RegisterMetricsServer(server, grpcserver.NewMetricsServer(m, false, ""))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("error dialing bufnet: %v", err)
+	}
+	defer conn.Close()
+
+	var pollCount int64 = 2
+	metrics := append(collectMetrics(), storage.Metrics{ID: "PollCount", MType: "counter", Delta: &pollCount})
+	err = streamMetrics(pb.NewMetricsClient(conn), metrics, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), m.Snapshot().Counter["PollCount"])
+	assert.Len(t, m.Snapshot().Gauge, 28)
+
+	// с id агента сервер считает PollCount накопленным и находит перезапуск по уменьшению
+	source = "agent1"
+	defer func() { source = "" }()
+	for _, v := range []int64{3, 5, 1} {
+		pollCount := v
+		err = streamMetrics(pb.NewMetricsClient(conn), []storage.Metrics{{ID: "PollCount", MType: "counter", Delta: &pollCount}}, "")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(8), m.Snapshot().Counter["PollCount"])
+}
@@ -11,9 +11,12 @@ import (
 	"github.com/Nchezhegova/metrics-alerts/internal/config"
 	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
 	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	pb "github.com/Nchezhegova/metrics-alerts/internal/proto"
 	"github.com/Nchezhegova/metrics-alerts/internal/storage"
 	"github.com/shirou/gopsutil/v3/mem"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"io"
 	"math/rand"
 	"net/http"
@@ -39,6 +42,9 @@ var (
 )
 var key *rsa.PublicKey
 
+// source is the agent id sent with the metrics, the server uses it to detect counter resets
+var source string
+
 // printBuildInfo prints the build information.
 func printBuildInfo() {
 	// Command to get the commit value
@@ -84,7 +90,7 @@ func commonSend(body []byte, url string, hashkey string) {
 	if key != nil {
 		encryptCompressBody, err = helpers.EncryptData(compressBody.(*bytes.Buffer).Bytes(), key)
 		if err != nil {
-			log.Logger.Info("Error closing compressed:", zap.Error(err))
+			log.Logger.Info("Error encrypting body:", zap.Error(err))
 			return
 		}
 	} else {
@@ -99,6 +105,9 @@ func commonSend(body []byte, url string, hashkey string) {
 	}
 	req.Header.Set("Content-Encoding", "gzip")
 	req.Header.Set("Content-Type", "application/json")
+	if source != "" {
+		req.Header.Set(storage.SourceHeader, source)
+	}
 
 	if hashkey != "" {
 		compressedData := compressBody.(*bytes.Buffer).Bytes()
@@ -219,6 +228,17 @@ func collectgopsutilMetrics() []storage.Metrics {
 	return metrics
 }
 
+// withLabels attaches the static labels to every metric
+func withLabels(metrics []storage.Metrics, labels map[string]string) []storage.Metrics {
+	if len(labels) == 0 {
+		return metrics
+	}
+	for i := range metrics {
+		metrics[i].Labels = labels
+	}
+	return metrics
+}
+
 func workers(jobs <-chan storage.Metrics, addr string, hashkey string, wg *sync.WaitGroup) {
 	for {
 		job, ok := <-jobs
@@ -252,6 +272,31 @@ func main() {
 			return
 		}
 	}
+	source = conf.Source
+	if source == "" {
+		if source, err = os.Hostname(); err != nil {
+			log.Logger.Info("Error getting host name:", zap.Error(err))
+		}
+	}
+	labels, err := storage.ParseLabels(conf.Labels)
+	if err != nil {
+		log.Logger.Info("Error parsing labels:", zap.Error(err))
+		return
+	}
+	var grpcClient pb.MetricsClient
+	if conf.Transport == config.TransportGRPC {
+		if key != nil {
+			log.Logger.Info("gRPC transport does not support the crypto key")
+			return
+		}
+		conn, err := grpc.Dial(conf.GRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Logger.Info("Error connecting to gRPC server:", zap.Error(err))
+			return
+		}
+		defer conn.Close()
+		grpcClient = pb.NewMetricsClient(conn)
+	}
 	pollInterval := time.Duration(conf.PollInterval) * time.Second
 	reportInterval := time.Duration(conf.ReportInterval) * time.Second
 
@@ -266,7 +311,7 @@ func main() {
 	go func() {
 		for {
 			mu.Lock()
-			metrics = collectMetrics()
+			metrics = withLabels(collectMetrics(), labels)
 			pollCount++
 			mu.Unlock()
 			time.Sleep(pollInterval)
@@ -277,7 +322,7 @@ func main() {
 	go func() {
 		for {
 			mu.Lock()
-			psMetrics = collectgopsutilMetrics()
+			psMetrics = withLabels(collectgopsutilMetrics(), labels)
 			mu.Unlock()
 			time.Sleep(pollInterval)
 		}
@@ -291,20 +336,29 @@ func main() {
 	for {
 		time.Sleep(reportInterval)
 		mu.Lock()
-		for index := range metrics {
-			wgs.Add(1)
-			jobs <- metrics[index]
-		}
-		for index := range psMetrics {
-			wgs.Add(1)
-			jobs <- psMetrics[index]
-		}
 		m := storage.Metrics{
-			ID:    "PollCount",
-			MType: config.Counter,
-			Delta: &pollCount,
+			ID:     "PollCount",
+			MType:  config.Counter,
+			Delta:  &pollCount,
+			Labels: labels,
+		}
+		if grpcClient != nil {
+			batch := make([]storage.Metrics, 0, len(metrics)+len(psMetrics)+1)
+			batch = append(batch, metrics...)
+			batch = append(batch, psMetrics...)
+			batch = append(batch, m)
+			sendGRPCMetrics(grpcClient, batch, conf.Hash)
+		} else {
+			for index := range metrics {
+				wgs.Add(1)
+				jobs <- metrics[index]
+			}
+			for index := range psMetrics {
+				wgs.Add(1)
+				jobs <- psMetrics[index]
+			}
+			sendMetric(m, conf.Addr, conf.Hash)
 		}
-		sendMetric(m, conf.Addr, conf.Hash)
 		mu.Unlock()
 
 		select {
@@ -38,3 +38,16 @@ func TestSendMetric(t *testing.T) {
 	defer server.Close()
 
 }
+
+func TestWithLabels(t *testing.T) {
+	labels := map[string]string{"host": "web1", "env": "prod"}
+	metrics := withLabels(collectMetrics(), labels)
+	for _, m := range metrics {
+		if m.Labels["host"] != "web1" || m.Labels["env"] != "prod" {
+			t.Errorf("expected static labels on %s, got %v", m.ID, m.Labels)
+		}
+	}
+	if metrics = withLabels(collectgopsutilMetrics(), nil); metrics[0].Labels != nil {
+		t.Errorf("expected no labels, got %v", metrics[0].Labels)
+	}
+}
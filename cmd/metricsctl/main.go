@@ -0,0 +1,38 @@
+// Command metricsctl maintains the metrics stores of the server.
+//
+// Usage:
+//
+//	metricsctl migrate -from <file or DSN> -to <file or DSN> [-conflict overwrite|add|skip] [-dry-run]
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// commands maps the subcommand name to its implementation, run gets the arguments after the name
+var commands = map[string]func(args []string) error{
+	"migrate": runMigrate,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: metricsctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  migrate  copy gauges and counters between a snapshot file and Postgres")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Conflict policies for the series that already exist in the target
+const (
+	conflictOverwrite = "overwrite" // значение источника заменяет значение приемника
+	conflictAdd       = "add"       // счетчики складываются, gauge заменяются
+	conflictSkip      = "skip"      // значение приемника остается
+)
+
+// endpoint is a store the metrics are copied from or to
+type endpoint interface {
+	// load returns the content of the store
+	load(c context.Context) (storage.Snapshot, error)
+	// save writes the changed series, merged is the whole content of the store after the migration
+	save(c context.Context, changes storage.Snapshot, merged storage.Snapshot) error
+	close() error
+}
+
+// fileEndpoint is a snapshot file written by helpers.WriteFile, it is rewritten as a whole
+type fileEndpoint struct {
+	path string
+}
+
+func (f fileEndpoint) load(c context.Context) (storage.Snapshot, error) {
+	return helpers.ReadSnapshot(f.path)
+}
+
+func (f fileEndpoint) save(c context.Context, changes storage.Snapshot, merged storage.Snapshot) error {
+	return helpers.SaveSnapshot(merged, f.path)
+}
+
+func (f fileEndpoint) close() error {
+	return nil
+}
+
+// dbEndpoint is the Postgres storage, only the changed series are written
+type dbEndpoint struct {
+	d *storage.DBStorage
+}
+
+func (e dbEndpoint) load(c context.Context) (storage.Snapshot, error) {
+	return e.d.Snapshot(c)
+}
+
+func (e dbEndpoint) save(c context.Context, changes storage.Snapshot, merged storage.Snapshot) error {
+	return e.d.Restore(c, changes)
+}
+
+func (e dbEndpoint) close() error {
+	return e.d.Close()
+}
+
+// isDSN reports whether the address is a Postgres connection string rather than a file path
+func isDSN(addr string) bool {
+	return strings.HasPrefix(addr, "postgres://") || strings.HasPrefix(addr, "postgresql://")
+}
+
+// openEndpoint opens the database for a DSN, any other address is a snapshot file
+func openEndpoint(c context.Context, addr string) (endpoint, error) {
+	if !isDSN(addr) {
+		return fileEndpoint{path: addr}, nil
+	}
+	db, err := storage.OpenDB(c, addr, storage.DBPool{MaxOpenConns: 1})
+	if err != nil {
+		return nil, err
+	}
+	return dbEndpoint{d: storage.NewDBStorage(db, 0)}, nil
+}
+
+// migration is the source merged into the target by the conflict policy
+type migration struct {
+	changes storage.Snapshot
+	merged  storage.Snapshot
+
+	created int
+	updated int
+	skipped int
+	lines   []string
+}
+
+// merge applies the gauges and counters of src to a copy of dst, the other content of dst is kept.
+// The last values reported by the agents are copied with the created and updated counters,
+// otherwise the next cumulative report of an agent would be added whole again.
+// With overwrite the values of src win, with add the larger value of a source is kept:
+// the agent may have reported to both stores and continues from its latest report.
+// Skipped counters keep the values of dst.
+func merge(src storage.Snapshot, dst storage.Snapshot, policy string) *migration {
+	m := &migration{
+		changes: storage.Snapshot{
+			Gauge:    make(map[string]float64),
+			Counter:  make(map[string]int64),
+			Reported: make(map[string]map[string]int64),
+		},
+		merged: dst,
+	}
+	m.merged.Gauge = make(map[string]float64, len(dst.Gauge))
+	for k, v := range dst.Gauge {
+		m.merged.Gauge[k] = v
+	}
+	m.merged.Counter = make(map[string]int64, len(dst.Counter))
+	for k, v := range dst.Counter {
+		m.merged.Counter[k] = v
+	}
+	m.merged.Reported = make(map[string]map[string]int64, len(dst.Reported))
+	for k, sources := range dst.Reported {
+		for source, v := range sources {
+			setReported(m.merged.Reported, k, source, v)
+		}
+	}
+
+	for _, key := range sortedKeys(src.Gauge) {
+		v := src.Gauge[key]
+		old, exists := dst.Gauge[key]
+		switch {
+		case !exists:
+			m.created++
+			m.lines = append(m.lines, fmt.Sprintf("create gauge %s = %v", key, v))
+		case policy == conflictSkip:
+			m.skipped++
+			m.lines = append(m.lines, fmt.Sprintf("skip gauge %s, target has %v", key, old))
+			continue
+		default:
+			m.updated++
+			m.lines = append(m.lines, fmt.Sprintf("update gauge %s: %v -> %v", key, old, v))
+		}
+		m.changes.Gauge[key] = v
+		m.merged.Gauge[key] = v
+	}
+	for _, key := range sortedKeys(src.Counter) {
+		v := src.Counter[key]
+		old, exists := dst.Counter[key]
+		switch {
+		case !exists:
+			m.created++
+			m.lines = append(m.lines, fmt.Sprintf("create counter %s = %d", key, v))
+		case policy == conflictSkip:
+			m.skipped++
+			m.lines = append(m.lines, fmt.Sprintf("skip counter %s, target has %d", key, old))
+			continue
+		case policy == conflictAdd:
+			v += old
+			m.updated++
+			m.lines = append(m.lines, fmt.Sprintf("add counter %s: %d -> %d", key, old, v))
+		default:
+			m.updated++
+			m.lines = append(m.lines, fmt.Sprintf("update counter %s: %d -> %d", key, old, v))
+		}
+		m.changes.Counter[key] = v
+		m.merged.Counter[key] = v
+		for source, last := range src.Reported[key] {
+			if old, ok := m.merged.Reported[key][source]; ok && policy == conflictAdd {
+				last = max(old, last)
+			}
+			setReported(m.changes.Reported, key, source, last)
+			setReported(m.merged.Reported, key, source, last)
+		}
+	}
+	return m
+}
+
+// setReported saves the last value of the counter reported by the source
+func setReported(reported map[string]map[string]int64, key string, source string, v int64) {
+	if reported[key] == nil {
+		reported[key] = make(map[string]int64)
+	}
+	reported[key][source] = v
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// migrate copies the gauges and counters of src with the values reported by the agents into dst, a dry run prints the changes without writing them
+func migrate(c context.Context, src endpoint, dst endpoint, policy string, dryRun bool, out io.Writer) error {
+	data, err := src.load(c)
+	if err != nil {
+		return fmt.Errorf("read source: %w", err)
+	}
+	current, err := dst.load(c)
+	if errors.Is(err, helpers.ErrNoSnapshot) {
+		// файла приемника еще нет, он будет создан
+		current, err = storage.Snapshot{}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("read target: %w", err)
+	}
+
+	m := merge(data, current, policy)
+	if dryRun {
+		for _, line := range m.lines {
+			fmt.Fprintln(out, line)
+		}
+	}
+	fmt.Fprintf(out, "%d created, %d updated, %d skipped\n", m.created, m.updated, m.skipped)
+	if dryRun {
+		fmt.Fprintln(out, "Dry run, nothing written")
+		return nil
+	}
+	if m.created+m.updated == 0 {
+		return nil
+	}
+	if err = dst.save(c, m.changes, m.merged); err != nil {
+		return fmt.Errorf("write target: %w", err)
+	}
+	return nil
+}
+
+// runMigrate is the migrate command.
+// The server should be stopped, the target is read and written in separate steps.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := fs.String("from", "", "Snapshot file or Postgres DSN to copy from")
+	to := fs.String("to", "", "Snapshot file or Postgres DSN to copy to")
+	policy := fs.String("conflict", conflictOverwrite, "Policy for the series that exist in the target: overwrite, add or skip")
+	dryRun := fs.Bool("dry-run", false, "Print the changes without writing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New("both -from and -to are required")
+	}
+	if *from == *to {
+		return errors.New("-from and -to are the same store")
+	}
+	switch *policy {
+	case conflictOverwrite, conflictAdd, conflictSkip:
+	default:
+		return fmt.Errorf("unknowning conflict policy %q", *policy)
+	}
+
+	ctx := context.Background()
+	src, err := openEndpoint(ctx, *from)
+	if err != nil {
+		return fmt.Errorf("open source: %w", err)
+	}
+	defer src.close()
+	dst, err := openEndpoint(ctx, *to)
+	if err != nil {
+		return fmt.Errorf("open target: %w", err)
+	}
+	defer dst.close()
+	return migrate(ctx, src, dst, *policy, *dryRun, os.Stdout)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	src := storage.Snapshot{
+		Gauge:    map[string]float64{"Alloc": 2, "HeapAlloc": 3},
+		Counter:  map[string]int64{"PollCount": 5, "Requests": 1},
+		Reported: map[string]map[string]int64{"PollCount": {"agent1": 5, "agent2": 2}, "Requests": {"agent1": 1}},
+	}
+	dst := storage.Snapshot{
+		Gauge:      map[string]float64{"Alloc": 1},
+		Counter:    map[string]int64{"PollCount": 7},
+		Histograms: map[string]storage.Histogram{"latency": storage.NewHistogram([]float64{1})},
+		Reported:   map[string]map[string]int64{"PollCount": {"agent1": 4, "agent3": 3}},
+	}
+	tests := []struct {
+		policy   string
+		gauge    map[string]float64
+		counter  map[string]int64
+		reported map[string]map[string]int64
+		changes  int
+		skipped  int
+	}{
+		{
+			policy:   conflictOverwrite,
+			gauge:    map[string]float64{"Alloc": 2, "HeapAlloc": 3},
+			counter:  map[string]int64{"PollCount": 5, "Requests": 1},
+			reported: map[string]map[string]int64{"PollCount": {"agent1": 5, "agent2": 2, "agent3": 3}, "Requests": {"agent1": 1}},
+			changes:  4,
+		},
+		{
+			policy:   conflictAdd,
+			gauge:    map[string]float64{"Alloc": 2, "HeapAlloc": 3},
+			counter:  map[string]int64{"PollCount": 12, "Requests": 1},
+			reported: map[string]map[string]int64{"PollCount": {"agent1": 5, "agent2": 2, "agent3": 3}, "Requests": {"agent1": 1}},
+			changes:  4,
+		},
+		{
+			policy:   conflictSkip,
+			gauge:    map[string]float64{"Alloc": 1, "HeapAlloc": 3},
+			counter:  map[string]int64{"PollCount": 7, "Requests": 1},
+			reported: map[string]map[string]int64{"PollCount": {"agent1": 4, "agent3": 3}, "Requests": {"agent1": 1}},
+			changes:  2,
+			skipped:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			m := merge(src, dst, tt.policy)
+			assert.Equal(t, tt.gauge, m.merged.Gauge)
+			assert.Equal(t, tt.counter, m.merged.Counter)
+			assert.Equal(t, tt.reported, m.merged.Reported)
+			assert.Equal(t, dst.Histograms, m.merged.Histograms)
+			assert.Equal(t, tt.changes, len(m.changes.Gauge)+len(m.changes.Counter))
+			assert.Equal(t, tt.changes, m.created+m.updated)
+			assert.Equal(t, tt.skipped, m.skipped)
+			assert.Equal(t, int64(7), dst.Counter["PollCount"], "Expected the target not to be changed")
+			assert.Equal(t, int64(4), dst.Reported["PollCount"]["agent1"], "Expected the target not to be changed")
+		})
+	}
+}
+
+func TestMigrateFiles(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from.json")
+	to := filepath.Join(dir, "to.json")
+	assert.NoError(t, helpers.SaveSnapshot(storage.Snapshot{
+		Gauge:   map[string]float64{"Alloc": 2},
+		Counter: map[string]int64{"PollCount": 5},
+	}, from))
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	assert.NoError(t, migrate(ctx, fileEndpoint{from}, fileEndpoint{to}, conflictAdd, true, &out))
+	assert.Contains(t, out.String(), "create counter PollCount = 5")
+	assert.Contains(t, out.String(), "Dry run")
+	_, err := helpers.ReadSnapshot(to)
+	assert.ErrorIs(t, err, helpers.ErrNoSnapshot, "Expected a dry run not to write the target")
+
+	assert.NoError(t, migrate(ctx, fileEndpoint{from}, fileEndpoint{to}, conflictAdd, false, &out))
+	assert.NoError(t, migrate(ctx, fileEndpoint{from}, fileEndpoint{to}, conflictAdd, false, &out))
+	data, err := helpers.ReadSnapshot(to)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alloc": 2}, data.Gauge)
+	assert.Equal(t, map[string]int64{"PollCount": 10}, data.Counter)
+
+	err = migrate(ctx, fileEndpoint{filepath.Join(dir, "missing.json")}, fileEndpoint{to}, conflictAdd, false, &out)
+	assert.ErrorIs(t, err, helpers.ErrNoSnapshot)
+}
+
+func TestMigrateReported(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from.json")
+	to := filepath.Join(dir, "to.json")
+	ctx := context.Background()
+	report := func(m storage.MStorage, v int64) int64 {
+		list := []storage.Metrics{{ID: "PollCount", MType: config.Counter, Delta: &v}}
+		assert.NoError(t, m.UpdateFromSource(ctx, "agent1", list))
+		return *list[0].Delta
+	}
+
+	// агент отправил накопленные 5 в исходный сервер
+	m := &storage.MemStorage{}
+	assert.Equal(t, int64(5), report(m, 5))
+	helpers.WriteFile(m, from)
+
+	var out bytes.Buffer
+	assert.NoError(t, migrate(ctx, fileEndpoint{from}, fileEndpoint{to}, conflictOverwrite, false, &out))
+	data, err := helpers.ReadSnapshot(to)
+	assert.NoError(t, err)
+
+	// после переноса агент продолжает с 8, добавляется только прирост
+	assert.Equal(t, int64(8), report(storage.NewMemStorage(data), 8))
+}
+
+func TestRunMigrateFlags(t *testing.T) {
+	assert.Error(t, runMigrate([]string{"-from", "a.json"}))
+	assert.Error(t, runMigrate([]string{"-from", "a.json", "-to", "a.json"}))
+	assert.Error(t, runMigrate([]string{"-from", "a.json", "-to", "b.json", "-conflict", "merge"}))
+}
+
+func TestMigrateDB(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db, err := openEndpoint(ctx, config.DATEBASE)
+	if err != nil {
+		t.Skipf("Database is not available: %v", err)
+	}
+	defer db.close()
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from.json")
+	to := filepath.Join(dir, "to.json")
+	name := uuid.New().String()
+	assert.NoError(t, helpers.SaveSnapshot(storage.Snapshot{
+		Gauge:   map[string]float64{name: 2},
+		Counter: map[string]int64{name: 5},
+	}, from))
+
+	var out bytes.Buffer
+	assert.NoError(t, migrate(ctx, fileEndpoint{from}, db, conflictOverwrite, false, &out))
+	assert.NoError(t, migrate(ctx, fileEndpoint{from}, db, conflictAdd, false, &out))
+	assert.NoError(t, migrate(ctx, db, fileEndpoint{to}, conflictOverwrite, false, &out))
+	data, err := helpers.ReadSnapshot(to)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, data.Gauge[name])
+	assert.Equal(t, int64(10), data.Counter[name])
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/alerting"
 	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/grpcserver"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
 	"github.com/Nchezhegova/metrics-alerts/internal/http/handlers"
 	"github.com/Nchezhegova/metrics-alerts/internal/log"
 	"github.com/Nchezhegova/metrics-alerts/internal/storage"
@@ -9,6 +13,7 @@ import (
 	_ "net/http/pprof"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 // link flags
@@ -52,17 +57,107 @@ func main() {
 		log.Logger.Info("Error loading configuration:", zap.Error(err))
 		return
 	}
+	helpers.SnapshotsKept = conf.SnapshotsKept
 
+	var rules []alerting.Rule
+	if conf.AlertRules != "" {
+		rules, err = alerting.LoadRules(conf.AlertRules)
+		if err != nil {
+			log.Logger.Info("Error loading alert rules:", zap.Error(err))
+			return
+		}
+	}
+	engine, err := alerting.NewEngine(rules, time.Duration(conf.AlertInterval)*time.Second)
+	if err != nil {
+		log.Logger.Info("Error creating alert engine:", zap.Error(err))
+		return
+	}
+	if conf.AlertNotify != "" {
+		engine.Dispatcher, err = alerting.LoadDispatcher(conf.AlertNotify)
+		if err != nil {
+			log.Logger.Info("Error loading alert notifications config:", zap.Error(err))
+			return
+		}
+	}
+
+	var m storage.MStorage
+	restore := conf.Restore
 	if conf.AddrDB != "" {
-		DBMemory := storage.DBStorage{}
-		storage.OpenDB(conf.AddrDB)
-		handlers.StartServ(&DBMemory, conf.Addr, conf.StoreInterval, conf.FilePath, conf.Restore, conf.Hash, conf.KeyPath)
-		defer storage.DB.Close()
+		db, err := storage.OpenDB(context.Background(), conf.AddrDB, storage.DBPool{
+			MaxOpenConns: conf.DBMaxConns,
+			MaxIdleConns: conf.DBMaxConns,
+		})
+		if err != nil {
+			log.Logger.Info("Error opening the database:", zap.Error(err))
+			return
+		}
+		DBMemory := storage.NewDBStorage(db, time.Duration(conf.HistoryRetention)*time.Second)
+		defer DBMemory.Close()
+		if restore && !conf.RestoreSet {
+			// база общая для всех экземпляров, без явного -r снимок восстанавливается только в пустую базу,
+			// иначе каждый запуск откатывал бы счетчики к своему файлу
+			restore, err = DBMemory.Empty(context.Background())
+			if err != nil {
+				log.Logger.Info("Error reading the database:", zap.Error(err))
+				return
+			}
+		}
+		m = DBMemory
+	} else if conf.BoltPath != "" {
+		boltMemory, err := storage.OpenBolt(conf.BoltPath, conf.HistorySize, time.Duration(conf.HistoryRetention)*time.Second)
+		if err != nil {
+			log.Logger.Info("Error opening the bolt storage:", zap.Error(err))
+			return
+		}
+		defer boltMemory.Close()
+		m = boltMemory
 	} else {
-		globalMemory := storage.MemStorage{}
-		globalMemory.Counter = make(map[string]int64)
-		globalMemory.Gauge = make(map[string]float64)
-		handlers.StartServ(&globalMemory, conf.Addr, conf.StoreInterval, conf.FilePath, conf.Restore, conf.Hash, conf.KeyPath)
+		globalMemory := &storage.MemStorage{
+			HistorySize:      conf.HistorySize,
+			HistoryRetention: time.Duration(conf.HistoryRetention) * time.Second,
+		}
+		if conf.WALPath != "" {
+			if conf.FilePath == "" {
+				log.Logger.Info("WAL needs the file storage path for snapshots")
+				return
+			}
+			wal, err := storage.OpenWAL(conf.WALPath)
+			if err != nil {
+				log.Logger.Info("Error opening the WAL:", zap.Error(err))
+				return
+			}
+			defer wal.Close()
+			globalMemory.WAL = wal
+		}
+		m = globalMemory
+	}
+
+	// обновления из HTTP и gRPC попадают в один поток GET /stream
+	stream := storage.NewStream()
+	m = storage.NewPublisher(m, stream)
+
+	// хранилище восстанавливается до запуска серверов, иначе восстановление затерло бы первые обновления
+	persistence, err := helpers.RestoreStorage(m, conf.StoreInterval, conf.FilePath, restore)
+	if err != nil {
+		log.Logger.Info("Error restoring the storage:", zap.Error(err))
+		return
 	}
+
+	if conf.GRPCAddr != "" {
+		if conf.KeyPath != "" {
+			// тела gRPC не шифруются, сервер с ключом принимает метрики только по HTTP
+			log.Logger.Info("gRPC server does not support the crypto key")
+			return
+		}
+		grpcServer, err := grpcserver.Start(grpcserver.NewMetricsServer(m, persistence.SyncWrite, persistence.FilePath), conf.GRPCAddr, conf.Hash)
+		if err != nil {
+			log.Logger.Info("Error starting the gRPC server:", zap.Error(err))
+			return
+		}
+		defer grpcServer.GracefulStop()
+	}
+
+	handlers.StartServ(m, conf.Addr, persistence, conf.Hash, conf.KeyPath, engine,
+		time.Duration(conf.MetricTTL)*time.Second, stream)
 	defer log.Logger.Sync()
 }
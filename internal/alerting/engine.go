@@ -0,0 +1,254 @@
+package alerting
+
+import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State is the state of an alert
+type State string
+
+const (
+	StateInactive State = "inactive"
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// Alert holds the current state of a rule for one series.
+// A rule without matching series has one inactive alert without the series.
+type Alert struct {
+	Rule       string            `json:"rule"`
+	Metric     string            `json:"metric"`
+	Series     string            `json:"series,omitempty"` // ключ серии в хранилище, например load{host="web1"}
+	MType      string            `json:"type"`
+	State      State             `json:"state"`
+	Value      float64           `json:"value"`
+	Silenced   bool              `json:"silenced"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	ActiveAt   time.Time         `json:"active_at,omitempty"`
+	FiredAt    time.Time         `json:"fired_at,omitempty"`
+	ResolvedAt time.Time         `json:"resolved_at,omitempty"`
+}
+
+// id returns the rule name with the series key, it is unique among the alerts
+func (a Alert) id() string {
+	return alertID(a.Rule, a.Series)
+}
+
+// alertID joins the rule name and the series key
+func alertID(rule string, series string) string {
+	return rule + series
+}
+
+// counterState remembers the last seen counter value for stale rules
+type counterState struct {
+	value   int64
+	changed time.Time
+}
+
+// Engine evaluates rules against the storage and keeps alert states
+type Engine struct {
+	Interval   time.Duration
+	Dispatcher *Dispatcher
+
+	mu       sync.Mutex
+	rules    []Rule
+	alerts   map[string]*Alert
+	counters map[string]counterState
+	now      func() time.Time
+}
+
+// NewEngine returns a new Engine for the rules
+func NewEngine(rules []Rule, interval time.Duration) (*Engine, error) {
+	e := &Engine{
+		Interval: interval,
+		rules:    make([]Rule, len(rules)),
+		alerts:   make(map[string]*Alert),
+		counters: make(map[string]counterState),
+		now:      time.Now,
+	}
+	copy(e.rules, rules)
+	for i := range e.rules {
+		if err := e.rules[i].validate(); err != nil {
+			return nil, err
+		}
+		r := &e.rules[i]
+		e.alerts[alertID(r.Name, "")] = newAlert(r, "")
+	}
+	return e, nil
+}
+
+// newAlert returns an inactive alert of the rule for the series, the rule labels override the series labels
+func newAlert(r *Rule, series string) *Alert {
+	a := &Alert{
+		Rule:   r.Name,
+		Metric: r.Metric,
+		Series: series,
+		MType:  r.MType,
+		State:  StateInactive,
+		Labels: r.Labels,
+	}
+	if _, labels := storage.ParseMetricKey(series); len(labels) > 0 {
+		a.Labels = make(map[string]string, len(labels)+len(r.Labels))
+		for name, v := range labels {
+			a.Labels[name] = v
+		}
+		for name, v := range r.Labels {
+			a.Labels[name] = v
+		}
+	}
+	return a
+}
+
+// Evaluate checks every rule once against every series it matches and updates alert states
+func (e *Engine) Evaluate(c context.Context, m storage.MStorage) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	gauges, counters, err := storage.ListValues(c, m)
+	if err != nil {
+		log.Logger.Info("Error reading the metrics:", zap.Error(err))
+		return
+	}
+	silences, err := m.GetSilences(c)
+	if err != nil {
+		log.Logger.Info("Error reading silences:", zap.Error(err))
+	}
+	for i := range e.rules {
+		r := &e.rules[i]
+		matched := make(map[string]bool)
+		for _, series := range r.selectSeries(gauges, counters) {
+			matched[series] = true
+			id := alertID(r.Name, series)
+			a, ok := e.alerts[id]
+			if !ok {
+				a = newAlert(r, series)
+				e.alerts[id] = a
+			}
+			value, since, active := e.check(r, series, gauges, counters, now)
+			e.transition(a, r, value, active, since, now)
+			a.Silenced = silenced(silences, series, now)
+		}
+		if len(matched) == 0 {
+			// правило без серий остается в списке неактивным
+			matched[""] = true
+			if _, ok := e.alerts[alertID(r.Name, "")]; !ok {
+				e.alerts[alertID(r.Name, "")] = newAlert(r, "")
+			}
+		}
+		e.dropSeries(r, matched, now)
+	}
+}
+
+// dropSeries resolves the alerts of the series that are gone and removes them once they are reported as resolved
+func (e *Engine) dropSeries(r *Rule, matched map[string]bool, now time.Time) {
+	for id, a := range e.alerts {
+		if a.Rule != r.Name || matched[a.Series] {
+			continue
+		}
+		if a.State == StateInactive || a.State == StateResolved && a.ResolvedAt.Before(now) {
+			delete(e.alerts, id)
+			delete(e.counters, id)
+			continue
+		}
+		e.transition(a, r, a.Value, false, now, now)
+	}
+}
+
+// silenced reports whether any active silence matches the series
+func silenced(silences []storage.Silence, series string, now time.Time) bool {
+	for _, s := range silences {
+		if s.Active(now) && s.MatchesSeries(series) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the value of the series, since when the condition holds and whether it holds
+func (e *Engine) check(r *Rule, series string, gauges map[string]float64, counters map[string]int64, now time.Time) (float64, time.Time, bool) {
+	switch r.MType {
+	case config.Gauge:
+		v := gauges[series]
+		return v, now, r.compare(v)
+	case config.Counter:
+		v := counters[series]
+		if r.Condition != CondStale {
+			return float64(v), now, r.compare(float64(v))
+		}
+		id := alertID(r.Name, series)
+		last, seen := e.counters[id]
+		if !seen || v > last.value {
+			e.counters[id] = counterState{value: v, changed: now}
+			return float64(v), now, false
+		}
+		return float64(v), last.changed, true
+	}
+	return 0, now, false
+}
+
+// transition moves the alert between states
+func (e *Engine) transition(a *Alert, r *Rule, value float64, active bool, since time.Time, now time.Time) {
+	a.Value = value
+	if !active {
+		switch a.State {
+		case StateFiring:
+			a.State = StateResolved
+			a.ResolvedAt = now
+		case StatePending:
+			a.State = StateInactive
+			a.ActiveAt = time.Time{}
+		}
+		return
+	}
+	switch a.State {
+	case StateInactive, StateResolved:
+		a.State = StatePending
+		a.ActiveAt = since
+		a.FiredAt = time.Time{}
+		a.ResolvedAt = time.Time{}
+		if r.forDuration > 0 {
+			return
+		}
+		fallthrough
+	case StatePending:
+		if now.Sub(a.ActiveAt) >= r.forDuration {
+			a.State = StateFiring
+			a.FiredAt = now
+		}
+	}
+}
+
+// Alerts returns a copy of all alerts sorted by rule name and series
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		res = append(res, *a)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Rule != res[j].Rule {
+			return res[i].Rule < res[j].Rule
+		}
+		return res[i].Series < res[j].Series
+	})
+	return res
+}
+
+// Notify passes the current alerts to the dispatcher if it is set
+func (e *Engine) Notify(c context.Context) {
+	if e.Dispatcher == nil {
+		return
+	}
+	e.Dispatcher.Dispatch(c, e.Alerts())
+}
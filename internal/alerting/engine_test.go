@@ -0,0 +1,196 @@
+package alerting
+
+import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (f *fakeClock) now() time.Time {
+	return f.t
+}
+
+func newTestEngine(t *testing.T, rules []Rule) (*Engine, *fakeClock) {
+	e, err := NewEngine(rules, time.Second)
+	if err != nil {
+		t.Fatalf("error creating engine: %v", err)
+	}
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	e.now = clock.now
+	return e, clock
+}
+
+func TestEngine_GaugeThreshold(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 1},
+		Counter: map[string]int64{},
+	})
+	e, clock := newTestEngine(t, []Rule{
+		{Name: "HighHeap", Metric: "HeapAlloc", MType: "gauge", Condition: ">", Threshold: 100, For: "2m"},
+	})
+	ctx := context.Background()
+
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StateInactive, e.Alerts()[0].State)
+
+	m.GaugeStorage(ctx, "HeapAlloc", 500)
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StatePending, e.Alerts()[0].State)
+
+	clock.t = clock.t.Add(time.Minute)
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StatePending, e.Alerts()[0].State)
+
+	clock.t = clock.t.Add(time.Minute)
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StateFiring, e.Alerts()[0].State)
+	assert.Equal(t, 500.0, e.Alerts()[0].Value)
+
+	m.GaugeStorage(ctx, "HeapAlloc", 1)
+	clock.t = clock.t.Add(time.Minute)
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StateResolved, e.Alerts()[0].State)
+	assert.Equal(t, clock.t, e.Alerts()[0].ResolvedAt)
+}
+
+func TestEngine_PendingReset(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 500},
+		Counter: map[string]int64{},
+	})
+	e, _ := newTestEngine(t, []Rule{
+		{Name: "HighHeap", Metric: "HeapAlloc", MType: "gauge", Condition: ">", Threshold: 100, For: "2m"},
+	})
+	ctx := context.Background()
+
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StatePending, e.Alerts()[0].State)
+
+	m.GaugeStorage(ctx, "HeapAlloc", 1)
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StateInactive, e.Alerts()[0].State)
+}
+
+func TestEngine_FiresWithoutFor(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{},
+		Counter: map[string]int64{"PollCount": 10},
+	})
+	e, _ := newTestEngine(t, []Rule{
+		{Name: "ManyPolls", Metric: "PollCount", MType: "counter", Condition: ">=", Threshold: 10},
+	})
+	e.Evaluate(context.Background(), m)
+	assert.Equal(t, StateFiring, e.Alerts()[0].State)
+}
+
+func TestEngine_CounterStale(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{},
+		Counter: map[string]int64{"PollCount": 1},
+	})
+	e, clock := newTestEngine(t, []Rule{
+		{Name: "PollStuck", Metric: "PollCount", MType: "counter", Condition: "stale", For: "1m"},
+	})
+	ctx := context.Background()
+
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StateInactive, e.Alerts()[0].State)
+
+	clock.t = clock.t.Add(30 * time.Second)
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StatePending, e.Alerts()[0].State)
+
+	clock.t = clock.t.Add(30 * time.Second)
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StateFiring, e.Alerts()[0].State)
+
+	m.CountStorage(ctx, "PollCount", 1)
+	clock.t = clock.t.Add(10 * time.Second)
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StateResolved, e.Alerts()[0].State)
+}
+
+func TestEngine_MissingMetric(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{},
+		Counter: map[string]int64{},
+	})
+	e, _ := newTestEngine(t, []Rule{
+		{Name: "LowHeap", Metric: "HeapAlloc", MType: "gauge", Condition: "<", Threshold: 100},
+	})
+	e.Evaluate(context.Background(), m)
+	assert.Equal(t, StateInactive, e.Alerts()[0].State)
+}
+
+func TestEngine_Silenced(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 500},
+		Counter: map[string]int64{},
+	})
+	e, clock := newTestEngine(t, []Rule{
+		{Name: "HighHeap", Metric: "HeapAlloc", MType: "gauge", Condition: ">", Threshold: 100},
+	})
+	ctx := context.Background()
+	err := m.AddSilence(ctx, storage.Silence{ID: "1", Matcher: "Heap*", StartsAt: clock.t, EndsAt: clock.t.Add(time.Hour)})
+	assert.NoError(t, err)
+
+	e.Evaluate(ctx, m)
+	assert.Equal(t, StateFiring, e.Alerts()[0].State)
+	assert.True(t, e.Alerts()[0].Silenced)
+
+	clock.t = clock.t.Add(2 * time.Hour)
+	e.Evaluate(ctx, m)
+	assert.False(t, e.Alerts()[0].Silenced)
+}
+
+func TestEngine_LabelledSeries(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge: map[string]float64{
+			`load{host="web1"}`: 5,
+			`load{host="web2"}`: 1,
+			`load{host="db1"}`:  9,
+		},
+		Counter: map[string]int64{},
+	})
+	e, clock := newTestEngine(t, []Rule{
+		{Name: "HighLoad", Metric: "load", MType: "gauge", Condition: ">", Threshold: 2,
+			Match: []string{"host=~web.*"}, Labels: map[string]string{"severity": "page"}},
+	})
+	ctx := context.Background()
+
+	e.Evaluate(ctx, m)
+	alerts := e.Alerts()
+	if assert.Len(t, alerts, 2, "Expected one alert per matching series") {
+		assert.Equal(t, `load{host="web1"}`, alerts[0].Series)
+		assert.Equal(t, StateFiring, alerts[0].State)
+		assert.Equal(t, map[string]string{"host": "web1", "severity": "page"}, alerts[0].Labels)
+		assert.Equal(t, `load{host="web2"}`, alerts[1].Series)
+		assert.Equal(t, StateInactive, alerts[1].State)
+	}
+
+	err := m.AddSilence(ctx, storage.Silence{ID: "1", Matcher: `load{host="web1"}`, StartsAt: clock.t, EndsAt: clock.t.Add(time.Hour)})
+	assert.NoError(t, err)
+	e.Evaluate(ctx, m)
+	assert.True(t, e.Alerts()[0].Silenced)
+	assert.False(t, e.Alerts()[1].Silenced)
+
+	// серия удалена: оповещение разрешается, затем исчезает
+	_, err = m.DeleteMetrics(ctx, []storage.Metrics{{ID: "load", MType: "gauge", Labels: map[string]string{"host": "web1"}}})
+	assert.NoError(t, err)
+	clock.t = clock.t.Add(time.Minute)
+	e.Evaluate(ctx, m)
+	alerts = e.Alerts()
+	assert.Equal(t, StateResolved, alerts[0].State)
+	clock.t = clock.t.Add(time.Minute)
+	e.Evaluate(ctx, m)
+	alerts = e.Alerts()
+	if assert.Len(t, alerts, 1) {
+		assert.Equal(t, `load{host="web2"}`, alerts[0].Series)
+	}
+}
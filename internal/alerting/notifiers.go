@@ -0,0 +1,145 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookConfig describes a JSON webhook
+type WebhookConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// WebhookNotifier posts notifications as JSON to the URL
+type WebhookNotifier struct {
+	conf   WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a new WebhookNotifier
+func NewWebhookNotifier(conf WebhookConfig) *WebhookNotifier {
+	return &WebhookNotifier{
+		conf:   conf,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify posts the notification to the webhook
+func (w *WebhookNotifier) Notify(c context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(c, http.MethodPost, w.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.conf.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// FileConfig describes an append-only file sink
+type FileConfig struct {
+	Path string `json:"path"`
+}
+
+// FileNotifier appends notifications as JSON lines to the file
+type FileNotifier struct {
+	conf FileConfig
+	mu   sync.Mutex
+}
+
+// NewFileNotifier returns a new FileNotifier
+func NewFileNotifier(conf FileConfig) *FileNotifier {
+	return &FileNotifier{conf: conf}
+}
+
+// Notify appends the notification to the file
+func (f *FileNotifier) Notify(c context.Context, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.conf.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// SMTPConfig describes an SMTP server and recipients
+type SMTPConfig struct {
+	Addr     string   `json:"addr"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+}
+
+// SMTPNotifier sends notifications by e-mail
+type SMTPNotifier struct {
+	conf SMTPConfig
+}
+
+// NewSMTPNotifier returns a new SMTPNotifier
+func NewSMTPNotifier(conf SMTPConfig) *SMTPNotifier {
+	return &SMTPNotifier{conf: conf}
+}
+
+// Notify sends the notification as a plain text e-mail
+func (s *SMTPNotifier) Notify(c context.Context, n Notification) error {
+	var auth smtp.Auth
+	if s.conf.Username != "" {
+		host := s.conf.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", s.conf.Username, s.conf.Password, host)
+	}
+	return smtp.SendMail(s.conf.Addr, auth, s.conf.From, s.conf.To, s.message(n))
+}
+
+// message formats the notification as an e-mail message
+func (s *SMTPNotifier) message(n Notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.conf.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.conf.To, ", "))
+	// метки приходят от агентов, поэтому тема кодируется, чтобы CR/LF не добавили заголовки
+	subject := fmt.Sprintf("[%s:%d] %s", strings.ToUpper(n.Status), len(n.Alerts), n.GroupKey)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	for _, a := range n.Alerts {
+		metric := a.Metric
+		if a.Series != "" {
+			metric = a.Series
+		}
+		fmt.Fprintf(&b, "%s: %s %s = %v (%s)\r\n", a.Rule, a.MType, metric, a.Value, a.State)
+	}
+	return []byte(b.String())
+}
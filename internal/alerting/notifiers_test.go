@@ -0,0 +1,131 @@
+package alerting
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testNotification() Notification {
+	return Notification{
+		GroupKey: "{alertname=HighHeap}",
+		Status:   StatusFiring,
+		Alerts:   []Alert{{Rule: "HighHeap", Metric: "HeapAlloc", MType: "gauge", State: StateFiring, Value: 600}},
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(WebhookConfig{URL: server.URL})
+	assert.NoError(t, n.Notify(context.Background(), testNotification()))
+	assert.Equal(t, "HighHeap", got.Alerts[0].Rule)
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	n := NewWebhookNotifier(WebhookConfig{URL: server.URL})
+	assert.Error(t, n.Notify(context.Background(), testNotification()))
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.log")
+	n := NewFileNotifier(FileConfig{Path: path})
+	assert.NoError(t, n.Notify(context.Background(), testNotification()))
+	assert.NoError(t, n.Notify(context.Background(), testNotification()))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+}
+
+// fakeSMTP accepts one message and returns its data
+func fakeSMTP(l net.Listener, data chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	write := func(s string) {
+		_, _ = conn.Write([]byte(s + "\r\n"))
+	}
+	write("220 localhost fake smtp")
+	var body strings.Builder
+	inData := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				data <- body.String()
+				write("250 ok")
+				continue
+			}
+			body.WriteString(line)
+			continue
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			write("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			inData = true
+			write("354 go ahead")
+		case strings.HasPrefix(cmd, "QUIT"):
+			write("221 bye")
+			return
+		default:
+			write("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting listener: %v", err)
+	}
+	defer l.Close()
+	data := make(chan string, 1)
+	go fakeSMTP(l, data)
+
+	n := NewSMTPNotifier(SMTPConfig{
+		Addr: l.Addr().String(),
+		From: "alerts@localhost",
+		To:   []string{"oncall@localhost"},
+	})
+	assert.NoError(t, n.Notify(context.Background(), testNotification()))
+	msg := <-data
+	assert.Contains(t, msg, "Subject: [FIRING:1] {alertname=HighHeap}")
+	assert.Contains(t, msg, "HighHeap: gauge HeapAlloc = 600 (firing)")
+}
+
+func TestSMTPNotifier_HeaderInjection(t *testing.T) {
+	n := NewSMTPNotifier(SMTPConfig{From: "alerts@localhost", To: []string{"oncall@localhost"}})
+	notification := testNotification()
+	notification.GroupKey = "{host=a\r\nBcc: attacker@example.com}"
+	msg := string(n.message(notification))
+	assert.NotContains(t, msg, "\r\nBcc:")
+	assert.Contains(t, msg, "Subject: =?utf-8?q?")
+}
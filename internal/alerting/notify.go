@@ -0,0 +1,248 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification statuses
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Notification is a group of alerts delivered by notifiers
+type Notification struct {
+	GroupKey    string            `json:"group_key"`
+	GroupLabels map[string]string `json:"group_labels"`
+	Status      string            `json:"status"`
+	Alerts      []Alert           `json:"alerts"`
+	SentAt      time.Time         `json:"sent_at"`
+}
+
+// Notifier delivers notifications somewhere
+type Notifier interface {
+	Notify(context.Context, Notification) error
+}
+
+// groupState remembers what was sent for the group last time
+type groupState struct {
+	fingerprint string
+	firing      map[string]bool
+	sent        time.Time
+}
+
+// Dispatcher groups alerts by labels and sends them to notifiers without duplicates
+type Dispatcher struct {
+	GroupBy        []string
+	GroupInterval  time.Duration
+	RepeatInterval time.Duration
+
+	mu        sync.Mutex
+	notifiers []Notifier
+	groups    map[string]*groupState
+	now       func() time.Time
+}
+
+// NewDispatcher returns a new Dispatcher for the notifiers
+func NewDispatcher(groupBy []string, groupInterval time.Duration, repeatInterval time.Duration, notifiers ...Notifier) *Dispatcher {
+	return &Dispatcher{
+		GroupBy:        groupBy,
+		GroupInterval:  groupInterval,
+		RepeatInterval: repeatInterval,
+		notifiers:      notifiers,
+		groups:         make(map[string]*groupState),
+		now:            time.Now,
+	}
+}
+
+// groupLabels returns the labels of the alert used for grouping
+func (d *Dispatcher) groupLabels(a Alert) map[string]string {
+	labels := make(map[string]string, len(d.GroupBy))
+	for _, name := range d.GroupBy {
+		switch name {
+		case "alertname":
+			labels[name] = a.Rule
+		case "metric":
+			labels[name] = a.Metric
+		default:
+			labels[name] = a.Labels[name]
+		}
+	}
+	return labels
+}
+
+// groupKey builds a stable key from the group labels
+func groupKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+labels[k])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Dispatch sends notifications for groups whose firing alerts changed or need a repeat
+func (d *Dispatcher) Dispatch(c context.Context, alerts []Alert) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	grouped := make(map[string][]Alert)
+	labelsByKey := make(map[string]map[string]string)
+	for _, a := range alerts {
+		if a.State != StateFiring && a.State != StateResolved || a.Silenced {
+			continue
+		}
+		labels := d.groupLabels(a)
+		key := groupKey(labels)
+		grouped[key] = append(grouped[key], a)
+		labelsByKey[key] = labels
+	}
+
+	keys := make([]string, 0, len(grouped))
+	for key := range grouped {
+		keys = append(keys, key)
+	}
+	for key := range d.groups {
+		if _, ok := grouped[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		prev := d.groups[key]
+		firing := make(map[string]bool)
+		var send []Alert
+		for _, a := range grouped[key] {
+			if a.State == StateFiring {
+				firing[a.id()] = true
+				send = append(send, a)
+			} else if prev != nil && prev.firing[a.id()] {
+				send = append(send, a)
+			}
+		}
+		fingerprint := fingerprintOf(firing)
+
+		switch {
+		case prev == nil && len(firing) == 0:
+			continue
+		case prev != nil && fingerprint == prev.fingerprint:
+			if len(firing) == 0 || now.Sub(prev.sent) < d.RepeatInterval {
+				continue
+			}
+		case prev != nil && now.Sub(prev.sent) < d.GroupInterval:
+			continue
+		}
+
+		if len(send) == 0 {
+			delete(d.groups, key)
+			continue
+		}
+		status := StatusFiring
+		if len(firing) == 0 {
+			status = StatusResolved
+		}
+		d.send(c, Notification{
+			GroupKey:    key,
+			GroupLabels: labelsByKey[key],
+			Status:      status,
+			Alerts:      send,
+			SentAt:      now,
+		})
+		if len(firing) == 0 {
+			delete(d.groups, key)
+			continue
+		}
+		d.groups[key] = &groupState{fingerprint: fingerprint, firing: firing, sent: now}
+	}
+}
+
+// fingerprintOf returns the sorted list of firing alerts
+func fingerprintOf(firing map[string]bool) string {
+	names := make([]string, 0, len(firing))
+	for name := range firing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// send delivers the notification to every notifier and logs failures
+func (d *Dispatcher) send(c context.Context, n Notification) {
+	for _, notifier := range d.notifiers {
+		if err := notifier.Notify(c, n); err != nil {
+			log.Logger.Error("Error delivering alert notification:", zap.String("group", n.GroupKey),
+				zap.String("notifier", fmt.Sprintf("%T", notifier)), zap.Error(err))
+		}
+	}
+}
+
+// NotifyConfig describes the notifiers in the notification config file
+type NotifyConfig struct {
+	GroupBy        []string        `json:"group_by"`
+	GroupInterval  string          `json:"group_interval"`
+	RepeatInterval string          `json:"repeat_interval"`
+	Webhooks       []WebhookConfig `json:"webhooks"`
+	Files          []FileConfig    `json:"files"`
+	SMTP           []SMTPConfig    `json:"smtp"`
+}
+
+// LoadDispatcher reads the notification config file and returns a Dispatcher for it
+func LoadDispatcher(filePath string) (*Dispatcher, error) {
+	file, err := os.OpenFile(filePath, os.O_RDONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var conf NotifyConfig
+	if err = json.NewDecoder(file).Decode(&conf); err != nil {
+		return nil, err
+	}
+	groupInterval, err := parseDuration(conf.GroupInterval, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("group_interval: %w", err)
+	}
+	repeatInterval, err := parseDuration(conf.RepeatInterval, 4*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("repeat_interval: %w", err)
+	}
+
+	var notifiers []Notifier
+	for _, w := range conf.Webhooks {
+		notifiers = append(notifiers, NewWebhookNotifier(w))
+	}
+	for _, f := range conf.Files {
+		notifiers = append(notifiers, NewFileNotifier(f))
+	}
+	for _, s := range conf.SMTP {
+		notifiers = append(notifiers, NewSMTPNotifier(s))
+	}
+	groupBy := conf.GroupBy
+	if len(groupBy) == 0 {
+		groupBy = []string{"alertname"}
+	}
+	return NewDispatcher(groupBy, groupInterval, repeatInterval, notifiers...), nil
+}
+
+// parseDuration parses the duration or returns the default value for an empty string
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
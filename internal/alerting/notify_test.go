@@ -0,0 +1,121 @@
+package alerting
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+type fakeNotifier struct {
+	sent []Notification
+}
+
+func (f *fakeNotifier) Notify(c context.Context, n Notification) error {
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+func newTestDispatcher() (*Dispatcher, *fakeNotifier, *fakeClock) {
+	n := &fakeNotifier{}
+	d := NewDispatcher([]string{"severity"}, time.Minute, time.Hour, n)
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	d.now = clock.now
+	return d, n, clock
+}
+
+func TestDispatcher_Grouping(t *testing.T) {
+	d, n, _ := newTestDispatcher()
+	d.Dispatch(context.Background(), []Alert{
+		{Rule: "a", State: StateFiring, Labels: map[string]string{"severity": "critical"}},
+		{Rule: "b", State: StateFiring, Labels: map[string]string{"severity": "critical"}},
+		{Rule: "c", State: StateFiring, Labels: map[string]string{"severity": "warning"}},
+		{Rule: "d", State: StatePending, Labels: map[string]string{"severity": "warning"}},
+	})
+	assert.Len(t, n.sent, 2)
+	assert.Equal(t, "{severity=critical}", n.sent[0].GroupKey)
+	assert.Len(t, n.sent[0].Alerts, 2)
+	assert.Equal(t, "{severity=warning}", n.sent[1].GroupKey)
+	assert.Len(t, n.sent[1].Alerts, 1)
+}
+
+func TestDispatcher_DedupAndRepeat(t *testing.T) {
+	d, n, clock := newTestDispatcher()
+	alerts := []Alert{{Rule: "a", State: StateFiring}}
+	ctx := context.Background()
+
+	d.Dispatch(ctx, alerts)
+	d.Dispatch(ctx, alerts)
+	assert.Len(t, n.sent, 1)
+
+	clock.t = clock.t.Add(30 * time.Minute)
+	d.Dispatch(ctx, alerts)
+	assert.Len(t, n.sent, 1)
+
+	clock.t = clock.t.Add(30 * time.Minute)
+	d.Dispatch(ctx, alerts)
+	assert.Len(t, n.sent, 2)
+}
+
+func TestDispatcher_Flapping(t *testing.T) {
+	d, n, clock := newTestDispatcher()
+	ctx := context.Background()
+
+	d.Dispatch(ctx, []Alert{{Rule: "a", State: StateFiring}})
+	clock.t = clock.t.Add(10 * time.Second)
+	d.Dispatch(ctx, []Alert{{Rule: "a", State: StateResolved}})
+	clock.t = clock.t.Add(10 * time.Second)
+	d.Dispatch(ctx, []Alert{{Rule: "a", State: StateFiring}})
+	assert.Len(t, n.sent, 1)
+
+	clock.t = clock.t.Add(10 * time.Second)
+	d.Dispatch(ctx, []Alert{{Rule: "a", State: StateResolved}})
+	assert.Len(t, n.sent, 1)
+
+	clock.t = clock.t.Add(time.Minute)
+	d.Dispatch(ctx, []Alert{{Rule: "a", State: StateResolved}})
+	assert.Len(t, n.sent, 2)
+	assert.Equal(t, StatusResolved, n.sent[1].Status)
+
+	clock.t = clock.t.Add(time.Minute)
+	d.Dispatch(ctx, []Alert{{Rule: "a", State: StateResolved}})
+	assert.Len(t, n.sent, 2)
+}
+
+func TestLoadDispatcher(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "notify_test.json")
+	if err != nil {
+		t.Fatalf("failed to create temporary config file: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	_, err = tempFile.WriteString(`{
+		"group_by": ["severity"],
+		"repeat_interval": "1h",
+		"webhooks": [{"url": "http://localhost/hook"}],
+		"files": [{"path": "/tmp/alerts.log"}],
+		"smtp": [{"addr": "localhost:25", "from": "alerts@localhost", "to": ["oncall@localhost"]}]
+	}`)
+	if err != nil {
+		t.Fatalf("failed to write to temporary config file: %v", err)
+	}
+
+	d, err := LoadDispatcher(tempFile.Name())
+	assert.NoError(t, err)
+	assert.Len(t, d.notifiers, 3)
+	assert.Equal(t, time.Hour, d.RepeatInterval)
+	assert.Equal(t, 30*time.Second, d.GroupInterval)
+}
+
+func TestDispatcher_Silenced(t *testing.T) {
+	d, n, _ := newTestDispatcher()
+	ctx := context.Background()
+
+	d.Dispatch(ctx, []Alert{{Rule: "a", State: StateFiring, Silenced: true}})
+	assert.Len(t, n.sent, 0)
+
+	d.Dispatch(ctx, []Alert{{Rule: "a", State: StateFiring}})
+	assert.Len(t, n.sent, 1)
+}
@@ -0,0 +1,143 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"os"
+	"sort"
+	"time"
+)
+
+// Conditions supported by rules
+const (
+	CondGreater      = ">"
+	CondGreaterEqual = ">="
+	CondLess         = "<"
+	CondLessEqual    = "<="
+	CondEqual        = "=="
+	CondNotEqual     = "!="
+	// CondStale fires when a counter stopped increasing
+	CondStale = "stale"
+)
+
+// Rule describes one alert rule loaded from the rules file
+type Rule struct {
+	Name      string            `json:"name"`
+	Metric    string            `json:"metric"`
+	MType     string            `json:"type"`
+	Condition string            `json:"condition"`
+	Threshold float64           `json:"threshold"`
+	For       string            `json:"for"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Match selects the series of the metric by labels, e.g. host=web1 or env!~dev.*, all series by default
+	Match []string `json:"match,omitempty"`
+
+	forDuration time.Duration
+	matchers    []storage.Matcher
+}
+
+// LoadRules reads rules from the JSON file and validates them
+func LoadRules(filePath string) ([]Rule, error) {
+	file, err := os.OpenFile(filePath, os.O_RDONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []Rule
+	if err = json.NewDecoder(file).Decode(&rules); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for i := range rules {
+		if err = rules[i].validate(); err != nil {
+			return nil, err
+		}
+		if names[rules[i].Name] {
+			return nil, fmt.Errorf("duplicate rule name %q", rules[i].Name)
+		}
+		names[rules[i].Name] = true
+	}
+	return rules, nil
+}
+
+// validate checks the rule fields and parses the duration
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without name")
+	}
+	if r.Metric == "" {
+		return fmt.Errorf("rule %q: empty metric", r.Name)
+	}
+	if r.MType != config.Gauge && r.MType != config.Counter {
+		return fmt.Errorf("rule %q: unknowning metric type %q", r.Name, r.MType)
+	}
+	switch r.Condition {
+	case CondGreater, CondGreaterEqual, CondLess, CondLessEqual, CondEqual, CondNotEqual:
+	case CondStale:
+		if r.MType != config.Counter {
+			return fmt.Errorf("rule %q: condition %q is supported only for counters", r.Name, r.Condition)
+		}
+	default:
+		return fmt.Errorf("rule %q: unknowning condition %q", r.Name, r.Condition)
+	}
+	r.matchers = []storage.Matcher{{Name: storage.NameLabel, Type: storage.MatchEqual, Value: r.Metric}}
+	for _, s := range r.Match {
+		m, err := storage.ParseMatcher(s)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		r.matchers = append(r.matchers, m)
+	}
+	if r.For != "" {
+		d, err := time.ParseDuration(r.For)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		r.forDuration = d
+	}
+	return nil
+}
+
+// selectSeries returns the sorted keys of the series of the rule type that satisfy the rule matchers
+func (r *Rule) selectSeries(gauges map[string]float64, counters map[string]int64) []string {
+	var keys []string
+	add := func(key string) {
+		if id, labels := storage.ParseMetricKey(key); storage.MatchSeries(r.matchers, id, labels) {
+			keys = append(keys, key)
+		}
+	}
+	switch r.MType {
+	case config.Gauge:
+		for key := range gauges {
+			add(key)
+		}
+	case config.Counter:
+		for key := range counters {
+			add(key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// compare applies the threshold condition to the value
+func (r *Rule) compare(v float64) bool {
+	switch r.Condition {
+	case CondGreater:
+		return v > r.Threshold
+	case CondGreaterEqual:
+		return v >= r.Threshold
+	case CondLess:
+		return v < r.Threshold
+	case CondLessEqual:
+		return v <= r.Threshold
+	case CondEqual:
+		return v == r.Threshold
+	case CondNotEqual:
+		return v != r.Threshold
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package alerting
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadRules(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "rules_test.json")
+	if err != nil {
+		t.Fatalf("failed to create temporary rules file: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	_, err = tempFile.WriteString(`[
+		{"name": "HighHeap", "metric": "HeapAlloc", "type": "gauge", "condition": ">", "threshold": 5e8, "for": "2m"},
+		{"name": "PollStuck", "metric": "PollCount", "type": "counter", "condition": "stale", "for": "1m"}
+	]`)
+	if err != nil {
+		t.Fatalf("failed to write to temporary rules file: %v", err)
+	}
+
+	rules, err := LoadRules(tempFile.Name())
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+	assert.Equal(t, 2*time.Minute, rules[0].forDuration)
+	assert.Equal(t, 5e8, rules[0].Threshold)
+	assert.Equal(t, CondStale, rules[1].Condition)
+}
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{
+			name:    "valid gauge",
+			rule:    Rule{Name: "r", Metric: "HeapAlloc", MType: "gauge", Condition: ">", For: "30s"},
+			wantErr: false,
+		},
+		{
+			name:    "no name",
+			rule:    Rule{Metric: "HeapAlloc", MType: "gauge", Condition: ">"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			rule:    Rule{Name: "r", Metric: "HeapAlloc", MType: "histogram", Condition: ">"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown condition",
+			rule:    Rule{Name: "r", Metric: "HeapAlloc", MType: "gauge", Condition: "~"},
+			wantErr: true,
+		},
+		{
+			name:    "stale gauge",
+			rule:    Rule{Name: "r", Metric: "HeapAlloc", MType: "gauge", Condition: "stale"},
+			wantErr: true,
+		},
+		{
+			name:    "bad duration",
+			rule:    Rule{Name: "r", Metric: "PollCount", MType: "counter", Condition: "stale", For: "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "valid match",
+			rule:    Rule{Name: "r", Metric: "load", MType: "gauge", Condition: ">", Match: []string{"host=~web.*"}},
+			wantErr: false,
+		},
+		{
+			name:    "bad match",
+			rule:    Rule{Name: "r", Metric: "load", MType: "gauge", Condition: ">", Match: []string{"host"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func TestSetConfigFromFlags(t *testing.T) {
-	os.Args = []string{"cmd", "-a", "test_addr", "-i", "5", "-f", "/test/path", "-crypto_key", "/test/key", "-d", "test_db_dsn", "-k", "test_hash", "-c", "/test/config_file", "-p", "3", "-ri", "15", "-l", "10"}
+	os.Args = []string{"cmd", "-a", "test_addr", "-i", "5", "-f", "/test/path", "-wal", "/test/wal", "-sk", "5", "-crypto_key", "/test/key", "-d", "test_db_dsn", "-dc", "20", "-b", "/test/bolt", "-k", "test_hash", "-c", "/test/config_file", "-alerts", "/test/rules", "-ai", "20", "-notify", "/test/notify", "-hs", "50", "-hr", "60", "-ttl", "120", "-p", "3", "-ri", "15", "-l", "10", "-g", "test_grpc", "-t", "grpc", "-labels", "host=web1", "-source", "agent1"}
 
 	conf := NewConfig()
 
@@ -24,18 +24,51 @@ func TestSetConfigFromFlags(t *testing.T) {
 	if conf.Restore != true {
 		t.Errorf("expected Restore=false, got %t", conf.Restore)
 	}
+	if conf.RestoreSet {
+		t.Errorf("expected RestoreSet=false without -r, got %t", conf.RestoreSet)
+	}
 	if conf.KeyPath != "/test/key" {
 		t.Errorf("expected KeyPath=/test/key, got %s", conf.KeyPath)
 	}
 	if conf.AddrDB != "test_db_dsn" {
 		t.Errorf("expected AddrDB=test_db_dsn, got %s", conf.AddrDB)
 	}
+	if conf.BoltPath != "/test/bolt" {
+		t.Errorf("expected BoltPath=/test/bolt, got %s", conf.BoltPath)
+	}
+	if conf.WALPath != "/test/wal" {
+		t.Errorf("expected WALPath=/test/wal, got %s", conf.WALPath)
+	}
+	if conf.SnapshotsKept != 5 {
+		t.Errorf("expected SnapshotsKept=5, got %d", conf.SnapshotsKept)
+	}
+	if conf.DBMaxConns != 20 {
+		t.Errorf("expected DBMaxConns=20, got %d", conf.DBMaxConns)
+	}
 	if conf.Hash != "test_hash" {
 		t.Errorf("expected Hash=test_hash, got %s", conf.Hash)
 	}
 	if conf.ConfigFile != "/test/config_file" {
 		t.Errorf("expected ConfigFile=/test/config_file, got %s", conf.ConfigFile)
 	}
+	if conf.AlertRules != "/test/rules" {
+		t.Errorf("expected AlertRules=/test/rules, got %s", conf.AlertRules)
+	}
+	if conf.AlertInterval != 20 {
+		t.Errorf("expected AlertInterval=20, got %d", conf.AlertInterval)
+	}
+	if conf.AlertNotify != "/test/notify" {
+		t.Errorf("expected AlertNotify=/test/notify, got %s", conf.AlertNotify)
+	}
+	if conf.HistorySize != 50 {
+		t.Errorf("expected HistorySize=50, got %d", conf.HistorySize)
+	}
+	if conf.HistoryRetention != 60 {
+		t.Errorf("expected HistoryRetention=60, got %d", conf.HistoryRetention)
+	}
+	if conf.MetricTTL != 120 {
+		t.Errorf("expected MetricTTL=120, got %d", conf.MetricTTL)
+	}
 	if conf.PollInterval != 3 {
 		t.Errorf("expected PollInterval=3, got %d", conf.PollInterval)
 	}
@@ -45,20 +78,46 @@ func TestSetConfigFromFlags(t *testing.T) {
 	if conf.RateLimit != 10 {
 		t.Errorf("expected RateLimit=10, got %d", conf.RateLimit)
 	}
+	if conf.GRPCAddr != "test_grpc" {
+		t.Errorf("expected GRPCAddr=test_grpc, got %s", conf.GRPCAddr)
+	}
+	if conf.Transport != "grpc" {
+		t.Errorf("expected Transport=grpc, got %s", conf.Transport)
+	}
+	if conf.Labels != "host=web1" {
+		t.Errorf("expected Labels=host=web1, got %s", conf.Labels)
+	}
+	if conf.Source != "agent1" {
+		t.Errorf("expected Source=agent1, got %s", conf.Source)
+	}
 }
 
 func TestSetConfigFromEnv(t *testing.T) {
 	os.Setenv("ADDRESS", "test_addr")
 	os.Setenv("STORE_INTERVAL", "5")
 	os.Setenv("FILE_STORAGE_PATH", "/test/path")
+	os.Setenv("WAL_PATH", "/test/wal")
+	os.Setenv("SNAPSHOTS_KEPT", "5")
 	os.Setenv("RESTORE", "false")
 	os.Setenv("CRYPTO_KEY", "/test/key")
 	os.Setenv("DATABASE_DSN", "test_db_dsn")
+	os.Setenv("DATABASE_MAX_CONNS", "20")
+	os.Setenv("BOLT_PATH", "/test/bolt")
 	os.Setenv("HASH", "test_hash")
 	os.Setenv("CONFIG", "/test/config_file")
+	os.Setenv("ALERT_RULES", "/test/rules")
+	os.Setenv("ALERT_INTERVAL", "20")
+	os.Setenv("ALERT_NOTIFY", "/test/notify")
+	os.Setenv("HISTORY_SIZE", "50")
+	os.Setenv("HISTORY_RETENTION", "60")
+	os.Setenv("METRIC_TTL", "120")
 	os.Setenv("POLL_INTERVAL", "3")
 	os.Setenv("REPORT_INTERVAL", "15")
 	os.Setenv("RATE_LIMIT", "10")
+	os.Setenv("GRPC_ADDRESS", "test_grpc")
+	os.Setenv("TRANSPORT", "grpc")
+	os.Setenv("LABELS", "host=web1")
+	os.Setenv("SOURCE", "agent1")
 
 	conf := NewConfig()
 
@@ -76,18 +135,51 @@ func TestSetConfigFromEnv(t *testing.T) {
 	if conf.Restore {
 		t.Errorf("expected Restore=false, got %t", conf.Restore)
 	}
+	if !conf.RestoreSet {
+		t.Errorf("expected RestoreSet=true, got %t", conf.RestoreSet)
+	}
 	if conf.KeyPath != "/test/key" {
 		t.Errorf("expected KeyPath=/test/key, got %s", conf.KeyPath)
 	}
 	if conf.AddrDB != "test_db_dsn" {
 		t.Errorf("expected AddrDB=test_db_dsn, got %s", conf.AddrDB)
 	}
+	if conf.BoltPath != "/test/bolt" {
+		t.Errorf("expected BoltPath=/test/bolt, got %s", conf.BoltPath)
+	}
+	if conf.WALPath != "/test/wal" {
+		t.Errorf("expected WALPath=/test/wal, got %s", conf.WALPath)
+	}
+	if conf.SnapshotsKept != 5 {
+		t.Errorf("expected SnapshotsKept=5, got %d", conf.SnapshotsKept)
+	}
+	if conf.DBMaxConns != 20 {
+		t.Errorf("expected DBMaxConns=20, got %d", conf.DBMaxConns)
+	}
 	if conf.Hash != "test_hash" {
 		t.Errorf("expected Hash=test_hash, got %s", conf.Hash)
 	}
 	if conf.ConfigFile != "/test/config_file" {
 		t.Errorf("expected ConfigFile=/test/config_file, got %s", conf.ConfigFile)
 	}
+	if conf.AlertRules != "/test/rules" {
+		t.Errorf("expected AlertRules=/test/rules, got %s", conf.AlertRules)
+	}
+	if conf.AlertInterval != 20 {
+		t.Errorf("expected AlertInterval=20, got %d", conf.AlertInterval)
+	}
+	if conf.AlertNotify != "/test/notify" {
+		t.Errorf("expected AlertNotify=/test/notify, got %s", conf.AlertNotify)
+	}
+	if conf.HistorySize != 50 {
+		t.Errorf("expected HistorySize=50, got %d", conf.HistorySize)
+	}
+	if conf.HistoryRetention != 60 {
+		t.Errorf("expected HistoryRetention=60, got %d", conf.HistoryRetention)
+	}
+	if conf.MetricTTL != 120 {
+		t.Errorf("expected MetricTTL=120, got %d", conf.MetricTTL)
+	}
 	if conf.PollInterval != 3 {
 		t.Errorf("expected PollInterval=3, got %d", conf.PollInterval)
 	}
@@ -97,6 +189,18 @@ func TestSetConfigFromEnv(t *testing.T) {
 	if conf.RateLimit != 10 {
 		t.Errorf("expected RateLimit=10, got %d", conf.RateLimit)
 	}
+	if conf.GRPCAddr != "test_grpc" {
+		t.Errorf("expected GRPCAddr=test_grpc, got %s", conf.GRPCAddr)
+	}
+	if conf.Transport != "grpc" {
+		t.Errorf("expected Transport=grpc, got %s", conf.Transport)
+	}
+	if conf.Labels != "host=web1" {
+		t.Errorf("expected Labels=host=web1, got %s", conf.Labels)
+	}
+	if conf.Source != "agent1" {
+		t.Errorf("expected Source=agent1, got %s", conf.Source)
+	}
 }
 
 func TestSetConfigFromJSON(t *testing.T) {
@@ -111,13 +215,19 @@ func TestSetConfigFromJSON(t *testing.T) {
 		"address": "test_addr",
 		"store_interval": 5,
 		"file_storage_path": "/test/path",
+		"wal_path": "/test/wal",
+		"snapshots_kept": 5,
 		"restore": false,
 		"crypto_key": "/test/key",
 		"database_dsn": "test_db_dsn",
+		"bolt_path": "/test/bolt",
 		"hash": "test_hash",
 		"poll_interval": 3,
 		"report_interval": 15,
-		"rate_limit": 10
+		"rate_limit": 10,
+		"labels": "env=prod",
+		"source": "agent1",
+		"metric_ttl": 120
 	}`)
 	if err != nil {
 		t.Fatalf("failed to write to temporary config file: %v", err)
@@ -143,12 +253,24 @@ func TestSetConfigFromJSON(t *testing.T) {
 	if conf.Restore != false {
 		t.Errorf("expected Restore=false, got %t", conf.Restore)
 	}
+	if conf.MetricTTL != 120 {
+		t.Errorf("expected MetricTTL=120, got %d", conf.MetricTTL)
+	}
 	if conf.KeyPath != "/test/key" {
 		t.Errorf("expected KeyPath=/test/key, got %s", conf.KeyPath)
 	}
 	if conf.AddrDB != "test_db_dsn" {
 		t.Errorf("expected AddrDB=test_db_dsn, got %s", conf.AddrDB)
 	}
+	if conf.BoltPath != "/test/bolt" {
+		t.Errorf("expected BoltPath=/test/bolt, got %s", conf.BoltPath)
+	}
+	if conf.WALPath != "/test/wal" {
+		t.Errorf("expected WALPath=/test/wal, got %s", conf.WALPath)
+	}
+	if conf.SnapshotsKept != 3 {
+		t.Errorf("expected SnapshotsKept=3, got %d", conf.SnapshotsKept)
+	}
 	if conf.Hash != "test_hash" {
 		t.Errorf("expected Hash=test_hash, got %s", conf.Hash)
 	}
@@ -161,4 +283,10 @@ func TestSetConfigFromJSON(t *testing.T) {
 	if conf.RateLimit != 5 {
 		t.Errorf("expected RateLimit=5, got %d", conf.RateLimit)
 	}
+	if conf.Labels != "env=prod" {
+		t.Errorf("expected Labels=env=prod, got %s", conf.Labels)
+	}
+	if conf.Source != "agent1" {
+		t.Errorf("expected Source=agent1, got %s", conf.Source)
+	}
 }
@@ -0,0 +1,94 @@
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"io"
+)
+
+// HashHeader is the metadata key of the request hash, the same as the HTTP header
+const HashHeader = "HashSHA256"
+
+var errInvalidHash = status.Error(codes.Unauthenticated, "invalid request hash")
+
+// HashInterceptors returns the server options that check the hash of the requests with the key.
+// Unlike HTTP the hash is required: a request without it is rejected.
+func HashInterceptors(hashKey string) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(c context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			msg, ok := req.(proto.Message)
+			if !ok || !checkHash(c, hashKey, msg) {
+				return nil, errInvalidHash
+			}
+			return handler(c, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if requestHash(ss.Context()) == nil {
+				return errInvalidHash
+			}
+			return handler(srv, &hashStream{ServerStream: ss, hashKey: hashKey})
+		}),
+	}
+}
+
+// requestHash returns the decoded hash from the request metadata, nil if it is missing or invalid
+func requestHash(c context.Context) []byte {
+	md, ok := metadata.FromIncomingContext(c)
+	if !ok {
+		return nil
+	}
+	values := md.Get(HashHeader)
+	if len(values) == 0 {
+		return nil
+	}
+	hash, err := base64.StdEncoding.DecodeString(values[0])
+	if err != nil || len(hash) == 0 {
+		return nil
+	}
+	return hash
+}
+
+// checkHash compares the hash of the messages with the one from the request metadata
+func checkHash(c context.Context, hashKey string, msgs ...proto.Message) bool {
+	hash := requestHash(c)
+	if hash == nil {
+		return false
+	}
+	expected, err := helpers.CalculateMessagesHash(hashKey, msgs...)
+	return err == nil && bytes.Equal(hash, expected)
+}
+
+// hashStream collects the received messages and checks their hash when the client closes the stream,
+// the handler gets io.EOF only for a valid stream, so nothing is saved otherwise
+type hashStream struct {
+	grpc.ServerStream
+	hashKey string
+	msgs    []proto.Message
+}
+
+// RecvMsg receives the next message
+func (s *hashStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == io.EOF {
+		if !checkHash(s.Context(), s.hashKey, s.msgs...) {
+			return errInvalidHash
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return errInvalidHash
+	}
+	s.msgs = append(s.msgs, proto.Clone(msg))
+	return nil
+}
@@ -0,0 +1,63 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	pb "github.com/Nchezhegova/metrics-alerts/internal/proto"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+// withHash adds the hash of the messages to the outgoing metadata
+func withHash(t *testing.T, key string, msgs ...proto.Message) context.Context {
+	hash, err := helpers.CalculateMessagesHash(key, msgs...)
+	assert.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), HashHeader, base64.StdEncoding.EncodeToString(hash))
+}
+
+func TestHashInterceptors(t *testing.T) {
+	m := &storage.MemStorage{}
+	client := newTestClient(t, m, HashInterceptors("secret")...)
+	req := &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 1}}}
+
+	_, err := client.UpdateMetrics(context.Background(), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.UpdateMetrics(withHash(t, "incorrect", req), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Empty(t, m.Snapshot().Gauge)
+
+	_, err = client.UpdateMetrics(withHash(t, "secret", req), req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, m.Snapshot().Gauge["HeapAlloc"])
+
+	msgs := []proto.Message{
+		&pb.Metric{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 1},
+		&pb.Metric{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 2},
+	}
+	send := func(c context.Context, msgs ...proto.Message) error {
+		stream, err := client.UpdateMetricsStream(c)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if err = stream.SendMsg(msg); err != nil {
+				return err
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	assert.Equal(t, codes.Unauthenticated, status.Code(send(context.Background(), msgs...)))
+	// подпись только первого сообщения не подходит ко всему потоку
+	assert.Equal(t, codes.Unauthenticated, status.Code(send(withHash(t, "secret", msgs[0]), msgs...)))
+	assert.NotContains(t, m.Snapshot().Counter, "PollCount")
+
+	assert.NoError(t, send(withHash(t, "secret", msgs...), msgs...))
+	assert.Equal(t, int64(3), m.Snapshot().Counter["PollCount"])
+}
@@ -0,0 +1,207 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	pb "github.com/Nchezhegova/metrics-alerts/internal/proto"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"sort"
+)
+
+// MetricsServer implements the Metrics gRPC service on top of the storage
+type MetricsServer struct {
+	pb.UnimplementedMetricsServer
+
+	storage   storage.MStorage
+	syncWrite bool
+	filePath  string
+}
+
+// NewMetricsServer returns a new MetricsServer
+func NewMetricsServer(m storage.MStorage, syncWrite bool, filePath string) *MetricsServer {
+	return &MetricsServer{
+		storage:   m,
+		syncWrite: syncWrite,
+		filePath:  filePath,
+	}
+}
+
+// Start listens on the address and serves the gRPC server in the background,
+// the requests are checked with the hash key when it is set
+func Start(s *MetricsServer, addr string, hashKey string) (*grpc.Server, error) {
+	listen, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var opts []grpc.ServerOption
+	if hashKey != "" {
+		opts = HashInterceptors(hashKey)
+	}
+	server := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(server, s)
+	go func() {
+		if err := server.Serve(listen); err != nil {
+			log.Logger.Error("Error starting the gRPC server:", zap.Error(err))
+		}
+	}()
+	return server, nil
+}
+
+// toStorage converts a gRPC metric to the storage metric
+func toStorage(m *pb.Metric) (storage.Metrics, error) {
+	switch m.GetType() {
+	case pb.Metric_GAUGE:
+		v := m.GetValue()
+		return storage.Metrics{ID: m.GetId(), MType: config.Gauge, Value: &v, Labels: m.GetLabels()}, nil
+	case pb.Metric_COUNTER:
+		d := m.GetDelta()
+		return storage.Metrics{ID: m.GetId(), MType: config.Counter, Delta: &d, Labels: m.GetLabels()}, nil
+	}
+	return storage.Metrics{}, status.Errorf(codes.InvalidArgument, "unknowning metric type %v", m.GetType())
+}
+
+// storageError converts the storage error to the gRPC status
+func storageError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, storage.ErrInvalidMetric):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.Logger.Info("Error storage:", zap.Error(err))
+	return status.Error(codes.Internal, err.Error())
+}
+
+// source returns the id of the agent from the request metadata
+func source(c context.Context) string {
+	md, ok := metadata.FromIncomingContext(c)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(storage.SourceHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// update saves the metrics and returns them with counter totals
+func (s *MetricsServer) update(c context.Context, metrics []*pb.Metric) (*pb.UpdateMetricsResponse, error) {
+	list := make([]storage.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if m.GetId() == "" {
+			return nil, status.Error(codes.InvalidArgument, "empty metric id")
+		}
+		if err := storage.ValidateID(m.GetId()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err := storage.ValidateLabels(m.GetLabels()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		metric, err := toStorage(m)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, metric)
+	}
+
+	if err := storage.UpdateReported(c, s.storage, source(c), list); err != nil {
+		return nil, storageError(err)
+	}
+	resp := &pb.UpdateMetricsResponse{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for i, m := range metrics {
+		res := &pb.Metric{Id: m.GetId(), Type: m.GetType(), Value: m.GetValue(), Labels: m.GetLabels()}
+		if m.GetType() == pb.Metric_COUNTER {
+			res.Delta = *list[i].Delta
+		}
+		resp.Metrics = append(resp.Metrics, res)
+	}
+	if s.syncWrite {
+		helpers.WriteFile(s.storage, s.filePath)
+	}
+	return resp, nil
+}
+
+// UpdateMetrics saves a batch of metrics
+func (s *MetricsServer) UpdateMetrics(c context.Context, req *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	return s.update(c, req.GetMetrics())
+}
+
+// UpdateMetricsStream receives metrics until the client closes the stream and saves them as one batch
+func (s *MetricsServer) UpdateMetricsStream(stream pb.Metrics_UpdateMetricsStreamServer) error {
+	var metrics []*pb.Metric
+	for {
+		m, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		metrics = append(metrics, m)
+	}
+	resp, err := s.update(stream.Context(), metrics)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+// GetMetric returns the current value of one metric series
+func (s *MetricsServer) GetMetric(c context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	res := &pb.Metric{Id: req.GetId(), Type: req.GetType(), Labels: req.GetLabels()}
+	key := storage.MetricKey(req.GetId(), req.GetLabels())
+	switch req.GetType() {
+	case pb.Metric_GAUGE:
+		v, err := s.storage.GetGauge(c, key)
+		if err != nil {
+			return nil, storageError(err)
+		}
+		res.Value = v
+	case pb.Metric_COUNTER:
+		v, err := s.storage.GetCount(c, key)
+		if err != nil {
+			return nil, storageError(err)
+		}
+		res.Delta = v
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknowning metric type %v", req.GetType())
+	}
+	return &pb.GetMetricResponse{Metric: res}, nil
+}
+
+// ListMetrics returns all metric series sorted by type, id and labels
+func (s *MetricsServer) ListMetrics(c context.Context, req *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	gauges, counters, err := storage.ListValues(c, s.storage)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	resp := &pb.ListMetricsResponse{Metrics: make([]*pb.Metric, 0, len(gauges)+len(counters))}
+	for key, v := range gauges {
+		id, labels := storage.ParseMetricKey(key)
+		resp.Metrics = append(resp.Metrics, &pb.Metric{Id: id, Type: pb.Metric_GAUGE, Value: v, Labels: labels})
+	}
+	for key, v := range counters {
+		id, labels := storage.ParseMetricKey(key)
+		resp.Metrics = append(resp.Metrics, &pb.Metric{Id: id, Type: pb.Metric_COUNTER, Delta: v, Labels: labels})
+	}
+	sort.Slice(resp.Metrics, func(i, j int) bool {
+		if resp.Metrics[i].Type != resp.Metrics[j].Type {
+			return resp.Metrics[i].Type < resp.Metrics[j].Type
+		}
+		if resp.Metrics[i].Id != resp.Metrics[j].Id {
+			return resp.Metrics[i].Id < resp.Metrics[j].Id
+		}
+		return storage.MetricKey("", resp.Metrics[i].Labels) < storage.MetricKey("", resp.Metrics[j].Labels)
+	})
+	return resp, nil
+}
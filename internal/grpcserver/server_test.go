@@ -0,0 +1,157 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	pb "github.com/Nchezhegova/metrics-alerts/internal/proto"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+)
+
+func newTestClient(t *testing.T, m storage.MStorage, opts ...grpc.ServerOption) pb.MetricsClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(server, NewMetricsServer(m, false, ""))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("error dialing bufnet: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewMetricsClient(conn)
+}
+
+func TestMetricsServer_UpdateMetrics(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   make(map[string]float64),
+		Counter: map[string]int64{"PollCount": 5},
+	})
+	client := newTestClient(t, m)
+
+	resp, err := client.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 10.5},
+		{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 3},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 10.5, m.Snapshot().Gauge["HeapAlloc"])
+	assert.Equal(t, int64(8), resp.GetMetrics()[1].GetDelta())
+
+	_, err = client.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "Unknown"},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMetricsServer_UpdateMetricsStream(t *testing.T) {
+	m := &storage.MemStorage{}
+	client := newTestClient(t, m)
+
+	stream, err := client.UpdateMetricsStream(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&pb.Metric{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 1}))
+	assert.NoError(t, stream.Send(&pb.Metric{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: 2}))
+	assert.NoError(t, stream.Send(&pb.Metric{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 7}))
+	resp, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Len(t, resp.GetMetrics(), 3)
+	assert.Equal(t, int64(3), m.Snapshot().Counter["PollCount"])
+	assert.Equal(t, 7.0, m.Snapshot().Gauge["HeapAlloc"])
+}
+
+func TestMetricsServer_GetMetric(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 36.6},
+		Counter: map[string]int64{"PollCount": 54},
+	})
+	client := newTestClient(t, m)
+	ctx := context.Background()
+
+	resp, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "HeapAlloc", Type: pb.Metric_GAUGE})
+	assert.NoError(t, err)
+	assert.Equal(t, 36.6, resp.GetMetric().GetValue())
+
+	resp, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "PollCount", Type: pb.Metric_COUNTER})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(54), resp.GetMetric().GetDelta())
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Unknown", Type: pb.Metric_GAUGE})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "HeapAlloc"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMetricsServer_ListMetrics(t *testing.T) {
+	m := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 36.6, "Alloc": 1},
+		Counter: map[string]int64{"PollCount": 54},
+	})
+	client := newTestClient(t, m)
+
+	resp, err := client.ListMetrics(context.Background(), &pb.ListMetricsRequest{})
+	assert.NoError(t, err)
+	var ids []string
+	for _, metric := range resp.GetMetrics() {
+		ids = append(ids, metric.GetId())
+	}
+	assert.Equal(t, []string{"Alloc", "HeapAlloc", "PollCount"}, ids)
+}
+
+func TestMetricsServer_Labels(t *testing.T) {
+	m := &storage.MemStorage{}
+	client := newTestClient(t, m)
+	ctx := context.Background()
+	labels := map[string]string{"host": "web1"}
+
+	_, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 10.5, Labels: labels},
+		{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Value: 1},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 10.5, m.Snapshot().Gauge[`HeapAlloc{host="web1"}`])
+
+	resp, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Labels: labels})
+	assert.NoError(t, err)
+	assert.Equal(t, 10.5, resp.GetMetric().GetValue())
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, list.GetMetrics(), 2)
+	assert.Empty(t, list.GetMetrics()[0].GetLabels())
+	assert.Equal(t, labels, list.GetMetrics()[1].GetLabels())
+
+	_, err = client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "HeapAlloc", Type: pb.Metric_GAUGE, Labels: map[string]string{"host-name": "web1"}},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMetricsServer_StorageError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := mocks.NewMockMStorage(ctrl)
+	m.EXPECT().GetGauge(gomock.Any(), "HeapAlloc").Return(0.0, errors.New("connection refused"))
+	m.EXPECT().GetStorage(gomock.Any()).Return(storage.Snapshot{}, errors.New("connection refused"))
+	client := newTestClient(t, m)
+	ctx := context.Background()
+
+	_, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "HeapAlloc", Type: pb.Metric_GAUGE})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	_, err = client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
@@ -1,10 +1,16 @@
 package helpers
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"github.com/Nchezhegova/metrics-alerts/internal/log"
 	"go.uber.org/zap"
@@ -57,18 +63,90 @@ func ConvertPrivateKey(key string) (*rsa.PrivateKey, error) {
 	return privateKey, nil
 }
 
+// Encrypted body format.
+// A body of exactly the RSA key size is the old format, the data encrypted with PKCS #1 v1.5.
+// Otherwise it is an envelope: the header of envelopeMagic, the version byte and the big-endian uint16 length
+// of the AES key encrypted with RSA-OAEP SHA-256, then the encrypted key, the GCM nonce and the data encrypted
+// with AES-256-GCM, the header is the additional data of GCM.
+const (
+	EnvelopeVersion = 1  // версия, которую пишет EncryptData
+	envelopeKeySize = 32 // AES-256
+)
+
+var envelopeMagic = []byte("MENV")
+
+// envelopeHeaderSize is the size of the magic, the version and the length of the encrypted key
+var envelopeHeaderSize = len(envelopeMagic) + 3
+
+// ErrInvalidEnvelope is returned by DecryptData for a body that is neither an envelope nor the old format
+var ErrInvalidEnvelope = errors.New("invalid encrypted envelope")
+
+// EncryptData encrypts the data of any size into an envelope with a random AES key
 func EncryptData(data []byte, publicKey *rsa.PublicKey) ([]byte, error) {
-	encryptedData, err := rsa.EncryptPKCS1v15(rand.Reader, publicKey, data)
+	aesKey := make([]byte, envelopeKeySize)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, aesKey, nil)
 	if err != nil {
 		return nil, err
 	}
-	return encryptedData, nil
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]byte, 0, envelopeHeaderSize+len(encryptedKey)+gcm.NonceSize()+len(data)+gcm.Overhead())
+	res = append(res, envelopeMagic...)
+	res = append(res, EnvelopeVersion)
+	res = binary.BigEndian.AppendUint16(res, uint16(len(encryptedKey)))
+	header := res[:envelopeHeaderSize]
+	res = append(res, encryptedKey...)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	res = append(res, nonce...)
+	return gcm.Seal(res, nonce, data, header), nil
 }
 
+// DecryptData decrypts an envelope written by EncryptData or a body of the old format
 func DecryptData(encryptedData []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
-	data, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, encryptedData)
+	if len(encryptedData) == privateKey.Size() {
+		// старые агенты шифруют весь body ключом RSA
+		return rsa.DecryptPKCS1v15(rand.Reader, privateKey, encryptedData)
+	}
+	if len(encryptedData) < envelopeHeaderSize || !bytes.Equal(encryptedData[:len(envelopeMagic)], envelopeMagic) {
+		return nil, ErrInvalidEnvelope
+	}
+	if version := encryptedData[len(envelopeMagic)]; version != EnvelopeVersion {
+		return nil, fmt.Errorf("%w: unknowning version %d", ErrInvalidEnvelope, version)
+	}
+	header := encryptedData[:envelopeHeaderSize]
+	keyLen := int(binary.BigEndian.Uint16(encryptedData[len(envelopeMagic)+1:]))
+	rest := encryptedData[envelopeHeaderSize:]
+	if len(rest) < keyLen {
+		return nil, ErrInvalidEnvelope
+	}
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, rest[:keyLen], nil)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	rest = rest[keyLen:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, ErrInvalidEnvelope
+	}
+	return gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
-	return data, nil
+	return cipher.NewGCM(block)
 }
@@ -1,9 +1,11 @@
 package helpers_test
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
@@ -32,3 +34,47 @@ func TestEncryptionAndDecryption(t *testing.T) {
 		t.Fatalf("Decrypted data doesn't match original data. Expected: %s, Got: %s", originalData, decryptedData)
 	}
 }
+
+func TestEncryptDataEnvelope(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	large := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1}`), 1000)
+
+	encrypted, err := helpers.EncryptData(large, &privateKey.PublicKey)
+	assert.NoError(t, err, "Expected the data larger than the key to be encrypted")
+	decrypted, err := helpers.DecryptData(encrypted, privateKey)
+	assert.NoError(t, err)
+	assert.Equal(t, large, decrypted)
+
+	empty, err := helpers.EncryptData(nil, &privateKey.PublicKey)
+	assert.NoError(t, err)
+	decrypted, err = helpers.DecryptData(empty, privateKey)
+	assert.NoError(t, err)
+	assert.Empty(t, decrypted)
+
+	legacy, err := rsa.EncryptPKCS1v15(rand.Reader, &privateKey.PublicKey, []byte("Hello, world!"))
+	assert.NoError(t, err)
+	decrypted, err = helpers.DecryptData(legacy, privateKey)
+	assert.NoError(t, err, "Expected the old format to be decrypted")
+	assert.Equal(t, []byte("Hello, world!"), decrypted)
+
+	tampered := bytes.Clone(encrypted)
+	tampered[len(tampered)-1] ^= 1
+	_, err = helpers.DecryptData(tampered, privateKey)
+	assert.Error(t, err)
+
+	version := bytes.Clone(encrypted)
+	version[4] = helpers.EnvelopeVersion + 1
+	_, err = helpers.DecryptData(version, privateKey)
+	assert.ErrorIs(t, err, helpers.ErrInvalidEnvelope)
+
+	_, err = helpers.DecryptData(encrypted[:10], privateKey)
+	assert.ErrorIs(t, err, helpers.ErrInvalidEnvelope)
+	_, err = helpers.DecryptData([]byte("invalid data"), privateKey)
+	assert.ErrorIs(t, err, helpers.ErrInvalidEnvelope)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, err = helpers.DecryptData(encrypted, otherKey)
+	assert.Error(t, err)
+}
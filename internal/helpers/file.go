@@ -1,51 +1,115 @@
 package helpers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Nchezhegova/metrics-alerts/internal/storage"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
+// snapshotVersion is the format of the snapshot file written by this version
+const snapshotVersion = 1
+
+// SnapshotsKept is the number of snapshot files kept, including the current one
+var SnapshotsKept = 3
+
+// snapshotMu serialises snapshot writes, they share the rotated file names
+var snapshotMu sync.Mutex
+
+// snapshot is the header of the snapshot file, Checksum is the sha256 of Data
+type snapshot struct {
+	Version  int             `json:"version"`
+	Checksum string          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// DefaultCompactInterval is used for the WAL when the store interval is 0
+const DefaultCompactInterval = time.Minute
+
+// ErrNoSnapshot is returned by ReadSnapshot when neither the snapshot nor its older copies can be read
+var ErrNoSnapshot = errors.New("no valid snapshot found")
+
+// WriteFile saves the metrics snapshot, the previous SnapshotsKept-1 snapshots are kept next to it.
+// The storage is read under snapshotMu, so of two concurrent writes the later one has the newer data.
 func WriteFile(m storage.MStorage, filePath string) {
-	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		fmt.Println("Error open file:", err)
-		return
-	}
-	defer file.Close()
-	data, err := json.Marshal(m)
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	data, err := m.GetStorage(context.Background())
 	if err != nil {
-		fmt.Println("Error convert metrics to str:", err)
+		fmt.Println("Error read storage:", err)
 		return
 	}
-	_, err = file.Write(data)
-	if err != nil {
+	if err = writeSnapshotLocked(data, filePath); err != nil {
 		fmt.Println("Error write file:", err)
-		return
 	}
 }
 
+// SaveSnapshot writes the snapshot like WriteFile and returns the error
+func SaveSnapshot(data storage.Snapshot, filePath string) error {
+	return writeSnapshot(data, filePath)
+}
+
+// readFile restores the newest valid snapshot into the storage
 func readFile(m storage.MStorage, filePath string) {
-	file, err := os.OpenFile(filePath, os.O_RDONLY, 0666)
+	data, err := ReadSnapshot(filePath)
 	if err != nil {
-		fmt.Println("Error open file:", err)
-		return
-	}
-	defer file.Close()
-	var data storage.MemStorage
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&data)
-	if err != nil {
-		fmt.Println("Error decode data:", err)
+		fmt.Println("No valid snapshot found, starting empty:", filePath)
 		return
 	}
 	m.SetStartData(data)
 }
 
+// ReadSnapshot returns the newest snapshot that passes the checksum, broken ones are skipped
+func ReadSnapshot(filePath string) (storage.Snapshot, error) {
+	for _, path := range snapshotPaths(filePath) {
+		data, err := readSnapshot(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			fmt.Println("Error read snapshot", path, ":", err)
+			continue
+		}
+		if path != filePath {
+			fmt.Println("Restored from older snapshot", path)
+		}
+		return data, nil
+	}
+	return storage.Snapshot{}, fmt.Errorf("%w: %s", ErrNoSnapshot, filePath)
+}
+
+// UsesFileSnapshot reports whether the storage is saved to the snapshot file and restored from it.
+// Bolt keeps every update in its own file, the snapshot would be an outdated copy of it.
+func UsesFileSnapshot(m storage.MStorage) bool {
+	switch storage.Unwrap(m).(type) {
+	case *storage.BoltStorage:
+		return false
+	}
+	return true
+}
+
+// WritesEachUpdate reports whether the snapshot is written after each update when the store interval is 0.
+// The database keeps every update itself, its snapshot is only written every interval.
+func WritesEachUpdate(m storage.MStorage) bool {
+	switch storage.Unwrap(m).(type) {
+	case *storage.DBStorage:
+		return false
+	}
+	return UsesFileSnapshot(m)
+}
+
+// SetWriterFile restores the snapshot into the storage and saves it every interval,
+// true means the snapshot has to be written after each update
 func SetWriterFile(m storage.MStorage, storeInterval int, filePath string, restore bool) bool {
-	if filePath == "" {
+	if filePath == "" || !UsesFileSnapshot(m) {
 		return false
 	}
 
@@ -53,7 +117,7 @@ func SetWriterFile(m storage.MStorage, storeInterval int, filePath string, resto
 		readFile(m, filePath)
 	}
 	if storeInterval == 0 {
-		return true
+		return WritesEachUpdate(m)
 	}
 
 	storeIntervalSecond := time.Duration(storeInterval) * time.Second
@@ -67,3 +131,156 @@ func SetWriterFile(m storage.MStorage, storeInterval int, filePath string, resto
 
 	return false
 }
+
+// snapshotPaths lists the snapshot files from the newest to the oldest
+func snapshotPaths(filePath string) []string {
+	paths := []string{filePath}
+	for i := 1; i < SnapshotsKept; i++ {
+		paths = append(paths, fmt.Sprintf("%s.%d", filePath, i))
+	}
+	return paths
+}
+
+// readSnapshot decodes a snapshot file and verifies its checksum.
+// Files written before the header was added are plain Snapshot JSON and are read as is.
+func readSnapshot(path string) (storage.Snapshot, error) {
+	var data storage.Snapshot
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return data, err
+	}
+	var s snapshot
+	if err = json.Unmarshal(raw, &s); err != nil {
+		return data, err
+	}
+	switch {
+	case s.Version == 0 && s.Data == nil:
+		err = json.Unmarshal(raw, &data)
+		return data, err
+	case s.Version > snapshotVersion:
+		return data, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	sum := sha256.Sum256(s.Data)
+	if hex.EncodeToString(sum[:]) != s.Checksum {
+		return data, errors.New("snapshot checksum mismatch")
+	}
+	err = json.Unmarshal(s.Data, &data)
+	return data, err
+}
+
+// writeSnapshot writes the metrics to a temporary file, syncs it and renames it over the snapshot,
+// so a crash leaves either the old or the new snapshot. Older snapshots are shifted to .1, .2 and so on.
+func writeSnapshot(data storage.Snapshot, filePath string) error {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	return writeSnapshotLocked(data, filePath)
+}
+
+// writeSnapshotLocked is writeSnapshot for the caller that holds snapshotMu
+func writeSnapshotLocked(m storage.Snapshot, filePath string) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	body, err := json.Marshal(snapshot{Version: snapshotVersion, Checksum: hex.EncodeToString(sum[:]), Data: data})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(filePath)
+	file, err := os.CreateTemp(dir, filepath.Base(filePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
+	if _, err = file.Write(body); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	paths := snapshotPaths(filePath)
+	for i := len(paths) - 1; i > 0; i-- {
+		if err = os.Rename(paths[i-1], paths[i]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes the renames in the directory durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// CompactWAL saves the snapshot and drops the WAL batches it contains
+func CompactWAL(m *storage.MemStorage, filePath string) error {
+	return m.Compact(func(data storage.Snapshot) error {
+		return writeSnapshot(data, filePath)
+	})
+}
+
+// Persistence is how the restored storage is saved, see RestoreStorage
+type Persistence struct {
+	FilePath  string
+	SyncWrite bool                // снапшот пишется после каждого обновления
+	WAL       *storage.MemStorage // память с WAL, сжимается в снапшот при остановке
+}
+
+// RestoreStorage restores the storage from the WAL or the snapshot file and starts saving it.
+// It is called before the servers start listening, so no update is overwritten by the restore.
+func RestoreStorage(m storage.MStorage, storeInterval int, filePath string, restore bool) (Persistence, error) {
+	p := Persistence{FilePath: filePath}
+	if ms, ok := storage.Unwrap(m).(*storage.MemStorage); ok && ms.WAL != nil {
+		if err := SetWAL(ms, storeInterval, filePath, restore); err != nil {
+			return p, err
+		}
+		p.WAL = ms
+		return p, nil
+	}
+	p.SyncWrite = SetWriterFile(m, storeInterval, filePath, restore)
+	return p, nil
+}
+
+// SetWAL restores the snapshot and replays the WAL over it when restore is set,
+// then compacts the WAL into the snapshot every interval
+func SetWAL(m *storage.MemStorage, compactInterval int, filePath string, restore bool) error {
+	if restore {
+		readFile(m, filePath)
+		if err := m.Replay(); err != nil {
+			return err
+		}
+	} else if err := m.TruncateWAL(); err != nil {
+		return err
+	}
+
+	interval := time.Duration(compactInterval) * time.Second
+	if interval <= 0 {
+		interval = DefaultCompactInterval
+	}
+	go func() {
+		for {
+			time.Sleep(interval)
+			if err := CompactWAL(m, filePath); err != nil {
+				fmt.Println("Error compact WAL:", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -1,49 +1,214 @@
 package helpers
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"github.com/Nchezhegova/metrics-alerts/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
 func TestWriteFile(t *testing.T) {
-	memStorage := storage.MemStorage{
-		Gauge: map[string]float64{"test": 1.0},
+	data := storage.Snapshot{
+		Gauge:   map[string]float64{"test": 1.0},
+		Counter: map[string]int64{},
 	}
-	filePath := "test.json"
+	filePath := filepath.Join(t.TempDir(), "test.json")
 
-	WriteFile(&memStorage, filePath)
+	WriteFile(storage.NewMemStorage(data), filePath)
 
-	file, err := os.Open(filePath)
+	decodedData, err := readSnapshot(filePath)
 	assert.NoError(t, err)
-	defer file.Close()
-
-	var decodedData storage.MemStorage
-	err = json.NewDecoder(file).Decode(&decodedData)
-	assert.NoError(t, err)
-	assert.Equal(t, memStorage, decodedData)
-	os.Remove(filePath)
+	assert.Equal(t, data, decodedData)
 }
 
 func TestSetWriterFile(t *testing.T) {
-	memStorage := storage.MemStorage{
-		Gauge: map[string]float64{"test": 1.0},
+	data := storage.Snapshot{
+		Gauge:   map[string]float64{"test": 1.0},
+		Counter: map[string]int64{},
 	}
-	filePath := "test.json"
+	filePath := filepath.Join(t.TempDir(), "test.json")
 	restore := false
 	storeInterval := 1
-	go SetWriterFile(&memStorage, storeInterval, filePath, restore)
+	go SetWriterFile(storage.NewMemStorage(data), storeInterval, filePath, restore)
 	time.Sleep(2 * time.Second)
-	file, err := os.Open(filePath)
+	decodedData, err := readSnapshot(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decodedData)
+}
+
+func TestRestoreStorage(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.json")
+	WriteFile(storage.NewMemStorage(storage.Snapshot{Counter: map[string]int64{"PollCount": 5}}), filePath)
+
+	m := &storage.MemStorage{}
+	p, err := RestoreStorage(m, 0, filePath, true)
+	assert.NoError(t, err)
+	assert.Equal(t, Persistence{FilePath: filePath, SyncWrite: true}, p)
+	assert.Equal(t, int64(5), m.Snapshot().Counter["PollCount"])
+}
+
+func TestSetWriterFileBolt(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "test.json")
+	WriteFile(storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"test": 1.0},
+		Counter: map[string]int64{},
+	}), filePath)
+
+	b, err := storage.OpenBolt(filepath.Join(dir, "metrics.db"), 0, 0)
+	assert.NoError(t, err)
+	defer b.Close()
+	assert.NoError(t, b.GaugeStorage(context.Background(), "test", 2.0))
+
+	assert.False(t, SetWriterFile(storage.NewPublisher(b, nil), 0, filePath, true))
+	v, err := b.GetGauge(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, v, "Expected bolt not to be restored from the snapshot file")
+}
+
+func TestSetWriterFileDB(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.json")
+	d := storage.NewDBStorage(nil, 0)
+	assert.True(t, UsesFileSnapshot(d))
+	assert.False(t, SetWriterFile(storage.NewPublisher(d, nil), 0, filePath, false),
+		"Expected the database snapshot not to be written after each update")
+}
+
+func TestReadFileWithSilences(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := storage.Snapshot{
+		Gauge:   map[string]float64{"test": 1.0},
+		Counter: map[string]int64{},
+		Silences: map[string]storage.Silence{
+			"1": {ID: "1", Matcher: "Poll*", StartsAt: start, EndsAt: start.Add(time.Hour)},
+		},
+	}
+	filePath := filepath.Join(t.TempDir(), "test_silences.json")
+	WriteFile(storage.NewMemStorage(data), filePath)
+
+	restored := &storage.MemStorage{}
+	readFile(restored, filePath)
+	assert.Equal(t, data.Silences, restored.Snapshot().Silences)
+}
+
+func TestSetWAL(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "metrics.json")
+	walPath := filepath.Join(dir, "metrics.wal")
+	ctx := context.Background()
+
+	wal, err := storage.OpenWAL(walPath)
+	assert.NoError(t, err)
+	m := &storage.MemStorage{WAL: wal}
+	assert.NoError(t, SetWAL(m, 3600, filePath, false))
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 2))
+	assert.NoError(t, CompactWAL(m, filePath))
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 3))
+	wal.Close()
+
+	wal, err = storage.OpenWAL(walPath)
 	assert.NoError(t, err)
-	defer file.Close()
-	var decodedData storage.MemStorage
-	err = json.NewDecoder(file).Decode(&decodedData)
+	defer wal.Close()
+	restored := &storage.MemStorage{WAL: wal}
+	p, err := RestoreStorage(storage.NewPublisher(restored, nil), 3600, filePath, true)
 	assert.NoError(t, err)
-	assert.Equal(t, memStorage, decodedData)
+	assert.Equal(t, Persistence{FilePath: filePath, WAL: restored}, p)
+	data := restored.Snapshot()
+	assert.Equal(t, int64(5), data.Counter["PollCount"])
+	assert.Equal(t, uint64(2), data.WALSeq)
+}
+
+func TestWriteFileKeepsSnapshots(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	for i := 1; i <= 5; i++ {
+		WriteFile(storage.NewMemStorage(storage.Snapshot{Counter: map[string]int64{"PollCount": int64(i)}}), filePath)
+	}
 
-	os.Remove(filePath)
+	files, err := filepath.Glob(filePath + "*")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, snapshotPaths(filePath), files)
+	for i, path := range snapshotPaths(filePath) {
+		data, err := readSnapshot(path)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5-i), data.Counter["PollCount"])
+	}
+}
+
+func TestReadFileFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(path string) error
+	}{
+		{
+			name: "torn write",
+			corrupt: func(path string) error {
+				raw, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				return os.WriteFile(path, raw[:len(raw)/2], 0666)
+			},
+		},
+		{
+			name: "checksum mismatch",
+			corrupt: func(path string) error {
+				raw, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				return os.WriteFile(path, bytes.Replace(raw, []byte(`"PollCount":2`), []byte(`"PollCount":9`), 1), 0666)
+			},
+		},
+		{
+			name: "unknown version",
+			corrupt: func(path string) error {
+				return os.WriteFile(path, []byte(`{"version":99,"checksum":"","data":{}}`), 0666)
+			},
+		},
+		{
+			name:    "missing",
+			corrupt: os.Remove,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "metrics.json")
+			WriteFile(storage.NewMemStorage(storage.Snapshot{Counter: map[string]int64{"PollCount": 1}}), filePath)
+			WriteFile(storage.NewMemStorage(storage.Snapshot{Counter: map[string]int64{"PollCount": 2}}), filePath)
+			assert.NoError(t, tt.corrupt(filePath))
+
+			restored := &storage.MemStorage{}
+			readFile(restored, filePath)
+			assert.Equal(t, int64(1), restored.Snapshot().Counter["PollCount"])
+		})
+	}
+}
+
+func TestReadFileLegacy(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.json")
+	assert.NoError(t, os.WriteFile(filePath, []byte(`{"gauge":{"test":1},"counter":{"PollCount":3}}`), 0666))
+
+	restored := &storage.MemStorage{}
+	readFile(restored, filePath)
+	data := restored.Snapshot()
+	assert.Equal(t, map[string]float64{"test": 1}, data.Gauge)
+	assert.Equal(t, map[string]int64{"PollCount": 3}, data.Counter)
+}
+
+func TestWriteFileBolt(t *testing.T) {
+	dir := t.TempDir()
+	b, err := storage.OpenBolt(filepath.Join(dir, "metrics.db"), 10, time.Hour)
+	assert.NoError(t, err)
+	defer b.Close()
+	assert.NoError(t, b.GaugeStorage(context.Background(), "Alloc", 1.5))
+	filePath := filepath.Join(dir, "metrics.json")
+
+	WriteFile(b, filePath)
+	data, err := ReadSnapshot(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"Alloc": 1.5}, data.Gauge)
 }
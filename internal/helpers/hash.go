@@ -3,6 +3,8 @@ package helpers
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 func CalculateHash(body []byte, key string) []byte {
@@ -11,3 +13,17 @@ func CalculateHash(body []byte, key string) []byte {
 	h.Write(body)
 	return h.Sum(nil)
 }
+
+// CalculateMessagesHash returns the hash of the gRPC messages, each one is encoded deterministically
+// and prefixed with its length, so a unary request and a client stream are signed the same way.
+func CalculateMessagesHash(key string, msgs ...proto.Message) ([]byte, error) {
+	var body []byte
+	for _, msg := range msgs {
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		body = protowire.AppendBytes(body, data)
+	}
+	return CalculateHash(body, key), nil
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/alerting"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// evaluateAlerts periodically evaluates alert rules against the storage and sends notifications
+func evaluateAlerts(e *alerting.Engine, m storage.MStorage) {
+	ctx := context.Background()
+	for {
+		time.Sleep(e.Interval)
+		e.Evaluate(ctx, m)
+		e.Notify(ctx)
+	}
+}
+
+// getAlerts displays the states of all alert rules
+func getAlerts(c *gin.Context, e *alerting.Engine) {
+	if e == nil {
+		c.JSON(http.StatusOK, []alerting.Alert{})
+		return
+	}
+	c.JSON(http.StatusOK, e.Alerts())
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Nchezhegova/metrics-alerts/internal/alerting"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_getAlerts(t *testing.T) {
+	ms := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 600},
+		Counter: map[string]int64{},
+	})
+	e, err := alerting.NewEngine([]alerting.Rule{
+		{Name: "HighHeap", Metric: "HeapAlloc", MType: "gauge", Condition: ">", Threshold: 500},
+	}, time.Second)
+	assert.NoError(t, err)
+	e.Evaluate(context.Background(), ms)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/alerts", nil)
+	getAlerts(c, e)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var alerts []alerting.Alert
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &alerts))
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, alerting.StateFiring, alerts[0].State)
+}
+
+func Test_getAlertsWithoutEngine(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/alerts", nil)
+	getAlerts(c, nil)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultRefresh is the reload interval of the dashboard in seconds when the request has no refresh param
+const defaultRefresh = 10
+
+//go:embed templates/dashboard.html
+var templateFiles embed.FS
+
+var dashboardTemplate = template.Must(template.ParseFS(templateFiles, "templates/dashboard.html"))
+
+// dashboardRow is a line of the dashboard table
+type dashboardRow struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+// dashboardPage is the data of the dashboard template
+type dashboardPage struct {
+	Rows    []dashboardRow
+	Total   int
+	Prefix  string
+	Sort    string
+	Match   []string
+	Refresh int // 0 - без автообновления
+	Updated string
+
+	SortByName string
+	SortByType string
+}
+
+// parseRefresh reads the refresh query param, the number of seconds between the reloads of the dashboard
+func parseRefresh(c *gin.Context) (int, error) {
+	if _, ok := c.GetQuery("refresh"); !ok {
+		return defaultRefresh, nil
+	}
+	return parseCount(c, "refresh")
+}
+
+// dashboardMetrics keeps the gauges and counters, the dashboard has no view of the histograms
+func dashboardMetrics(metrics []storage.Metrics) []storage.Metrics {
+	res := make([]storage.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric.MType == config.Gauge || metric.MType == config.Counter {
+			res = append(res, metric)
+		}
+	}
+	return res
+}
+
+// sortLink returns the url of the page sorted by the column, a second click on the column reverses the order
+func sortLink(query url.Values, current string, column string) string {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Del("offset")
+	if current == column {
+		q.Set("sort", "-"+column)
+	} else {
+		q.Set("sort", column)
+	}
+	return "?" + q.Encode()
+}
+
+// renderDashboard renders the page of the metrics, total is the number of them before the pagination
+func renderDashboard(c *gin.Context, metrics []storage.Metrics, total int, opts listOptions, refresh int) ([]byte, error) {
+	sort := opts.sortBy
+	if opts.desc {
+		sort = "-" + sort
+	}
+	query := c.Request.URL.Query()
+	page := dashboardPage{
+		Rows:       make([]dashboardRow, 0, len(metrics)),
+		Total:      total,
+		Prefix:     opts.prefix,
+		Sort:       sort,
+		Match:      query["match"],
+		Refresh:    refresh,
+		Updated:    time.Now().Format(time.DateTime),
+		SortByName: sortLink(query, sort, sortByName),
+		SortByType: sortLink(query, sort, sortByType),
+	}
+	for _, metric := range metrics {
+		row := dashboardRow{Name: metric.Key(), Type: metric.MType}
+		switch {
+		case metric.Value != nil:
+			row.Value = strconv.FormatFloat(*metric.Value, 'f', -1, 64)
+		case metric.Delta != nil:
+			row.Value = strconv.FormatInt(*metric.Delta, 10)
+		}
+		page.Rows = append(page.Rows, row)
+	}
+
+	var buf bytes.Buffer
+	if err := dashboardTemplate.Execute(&buf, page); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
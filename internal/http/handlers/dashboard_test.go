@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// getDashboard requests the root page with the Accept and Accept-Encoding headers
+func getDashboard(ms *storage.MemStorage, target string, accept string, encoding string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		printMetrics(c, ms)
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Accept-Encoding", encoding)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func Test_printMetricsDashboard(t *testing.T) {
+	ms := labelledStorage()
+	assert.NoError(t, ms.HistogramStorage(context.Background(), "latency", storage.NewHistogram([]float64{1})))
+
+	w := getDashboard(ms, "/", browserAccept, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "4", w.Header().Get(totalCountHeader))
+	body := w.Body.String()
+	assert.Contains(t, body, `<meta http-equiv="refresh" content="10">`)
+	assert.Contains(t, body, "<td>load{env=&#34;dev&#34;,host=&#34;web2&#34;}</td>")
+	assert.Contains(t, body, `<td class="value">0.1</td>`)
+	assert.Contains(t, body, `<td class="value">7</td>`)
+	assert.NotContains(t, body, "latency", "Expected no histograms on the dashboard")
+	assert.Contains(t, body, `href="?sort=-name"`)
+
+	w = getDashboard(ms, "/?prefix=req&refresh=0", browserAccept, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body = w.Body.String()
+	assert.NotContains(t, body, "http-equiv")
+	assert.NotContains(t, body, "load")
+	assert.Contains(t, body, `value="req"`)
+
+	w = getDashboard(ms, "/?refresh=-1", browserAccept, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = getDashboard(ms, "/", "image/png", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = getDashboard(ms, "/", "application/json", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"histogram"`)
+
+	w = getDashboard(ms, "/", browserAccept, "gzip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "<table>")
+}
+
+func Test_listFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: gin.MIMEHTML},
+		{accept: "*/*", want: gin.MIMEHTML},
+		{accept: browserAccept, want: gin.MIMEHTML},
+		{accept: "image/png", want: gin.MIMEHTML},
+		{accept: "application/json", want: gin.MIMEJSON},
+		{accept: "application/json, */*;q=0.5", want: gin.MIMEJSON},
+		{accept: "text/html;q=0.5, application/json", want: gin.MIMEJSON},
+		{accept: "application/json, text/html", want: gin.MIMEHTML},
+		{accept: "application/json;q=0.5, */*", want: gin.MIMEHTML},
+		{accept: "application/json;q=0", want: gin.MIMEHTML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			assert.Equal(t, tt.want, listFormat(tt.accept))
+		})
+	}
+}
+
+func Test_sortLink(t *testing.T) {
+	query := url.Values{"prefix": {"Heap"}, "offset": {"20"}}
+	assert.Equal(t, "?prefix=Heap&sort=type", sortLink(query, "name", sortByType))
+	assert.Equal(t, "?prefix=Heap&sort=-name", sortLink(query, "name", sortByName))
+	assert.Equal(t, "?prefix=Heap&sort=name", sortLink(query, "-name", sortByName))
+	assert.Equal(t, []string{"20"}, query["offset"], "Expected the query not to be changed")
+}
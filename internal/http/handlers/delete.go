@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// maxExpireInterval limits the interval of the TTL check for long TTLs
+const maxExpireInterval = time.Minute
+
+// deleteMetric deletes one series from url params, the labels are selected by query matchers like in getMetric
+func deleteMetric(c *gin.Context, m storage.MStorage, syncWrite bool, filePath string) {
+	matchers, err := parseMatchers(c)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	metric := storage.Metrics{ID: c.Param("name"), MType: c.Param("type")}
+	if len(matchers) > 0 {
+		key, err := findSeries(c, m, metric.MType, metric.ID, matchers)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		metric.ID, metric.Labels = storage.ParseMetricKey(key)
+	}
+
+	deleted, err := m.DeleteMetrics(c, []storage.Metrics{metric})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if deleted == 0 {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if syncWrite {
+		helpers.WriteFile(m, filePath)
+	}
+	c.Status(http.StatusOK)
+}
+
+// deleteMetricsFromBody deletes the series listed in the body, values of the metrics are ignored
+func deleteMetricsFromBody(c *gin.Context, m storage.MStorage, syncWrite bool, filePath string) {
+	var metricsList []storage.Metrics
+	if err := json.NewDecoder(c.Request.Body).Decode(&metricsList); err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := m.DeleteMetrics(c, metricsList)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if syncWrite && deleted > 0 {
+		helpers.WriteFile(m, filePath)
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// expireMetrics deletes the metrics that were not updated for the ttl
+func expireMetrics(m storage.MStorage, ttl time.Duration, syncWrite bool, filePath string) {
+	ctx := context.Background()
+	interval := min(ttl/2, maxExpireInterval)
+	for {
+		time.Sleep(interval)
+		deleted, err := m.Expire(ctx, time.Now().Add(-ttl))
+		if err != nil {
+			log.Logger.Info("Error expiring metrics:", zap.Error(err))
+			continue
+		}
+		if deleted > 0 {
+			log.Logger.Info("Expired metrics", zap.Int("deleted", deleted))
+			if syncWrite {
+				helpers.WriteFile(m, filePath)
+			}
+		}
+	}
+}
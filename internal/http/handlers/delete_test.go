@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func deleteRouter(ms *storage.MemStorage) *gin.Engine {
+	r := gin.New()
+	r.DELETE("/value/:type/:name", func(c *gin.Context) {
+		deleteMetric(c, ms, false, "")
+	})
+	r.POST("/delete/", func(c *gin.Context) {
+		deleteMetricsFromBody(c, ms, false, "")
+	})
+	return r
+}
+
+func Test_deleteMetric(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		want   storage.Snapshot
+	}{
+		{
+			name:   "gauge",
+			url:    "/value/gauge/HeapAlloc",
+			status: http.StatusOK,
+			want: storage.Snapshot{
+				Gauge:   map[string]float64{`HeapAlloc{host="web1"}`: 2},
+				Counter: map[string]int64{"PollCount": 5},
+			},
+		},
+		{
+			name:   "matchers",
+			url:    "/value/gauge/HeapAlloc?match=host%3Dweb1",
+			status: http.StatusOK,
+			want: storage.Snapshot{
+				Gauge:   map[string]float64{"HeapAlloc": 1},
+				Counter: map[string]int64{"PollCount": 5},
+			},
+		},
+		{
+			name:   "wrong type",
+			url:    "/value/counter/HeapAlloc",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "unknown type",
+			url:    "/value/unknown/HeapAlloc",
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := storage.NewMemStorage(storage.Snapshot{
+				Gauge:   map[string]float64{"HeapAlloc": 1, `HeapAlloc{host="web1"}`: 2},
+				Counter: map[string]int64{"PollCount": 5},
+			})
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodDelete, tt.url, nil)
+			deleteRouter(ms).ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				snapshot := ms.Snapshot()
+				assert.Equal(t, tt.want.Gauge, snapshot.Gauge)
+				assert.Equal(t, tt.want.Counter, snapshot.Counter)
+			}
+		})
+	}
+}
+
+func Test_deleteMetricsFromBody(t *testing.T) {
+	ms := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 1},
+		Counter: map[string]int64{"PollCount": 5},
+	})
+	r := deleteRouter(ms)
+
+	w := httptest.NewRecorder()
+	body := `[{"id":"HeapAlloc","type":"gauge"},{"id":"PollCount","type":"counter"},{"id":"Unknown","type":"counter"}]`
+	req, _ := http.NewRequest(http.MethodPost, "/delete/", bytes.NewBufferString(body))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted":2}`, w.Body.String())
+	snapshot := ms.Snapshot()
+	assert.Empty(t, snapshot.Gauge)
+	assert.Empty(t, snapshot.Counter)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/delete/", bytes.NewBufferString(`[{"id":"","type":"gauge"}]`))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_expireMetrics(t *testing.T) {
+	ms := storage.NewMemStorage(storage.Snapshot{Gauge: map[string]float64{"HeapAlloc": 1}})
+	go expireMetrics(ms, 20*time.Millisecond, false, "")
+	assert.Eventually(t, func() bool {
+		_, err := ms.GetGauge(context.Background(), "HeapAlloc")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+}
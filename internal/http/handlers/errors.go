@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// errBadRequest marks the request errors answered with 400
+var errBadRequest = errors.New("bad request")
+
+// errorStatus returns the response status for the error:
+// 404 for a missing metric, 400 for an invalid request and 500 for storage failures
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrInvalidMetric), errors.Is(err, errBadRequest):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// abortWithError aborts the request with the status of the error, storage failures are logged
+func abortWithError(c *gin.Context, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Logger.Info("Error storage:", zap.Error(err))
+	}
+	c.AbortWithStatus(status)
+}
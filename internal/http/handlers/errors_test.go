@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_errorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "Not found", err: storage.ErrNotFound, want: http.StatusNotFound},
+		{name: "Invalid metric", err: fmt.Errorf("%w: empty gauge value", storage.ErrInvalidMetric), want: http.StatusBadRequest},
+		{name: "Bad request", err: errBadRequest, want: http.StatusBadRequest},
+		{name: "Storage failure", err: errors.New("connection refused"), want: http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, errorStatus(test.err))
+		})
+	}
+}
+
+func Test_storageErrors(t *testing.T) {
+	errDB := errors.New("connection refused")
+	tests := []struct {
+		name   string
+		req    testreq
+		expect func(m *mocks.MockMStorage)
+		want   int
+	}{
+		{
+			name: "Update gauge with storage failure",
+			req:  testreq{url: "/update/gauge/w/1.5", method: http.MethodPost},
+			expect: func(m *mocks.MockMStorage) {
+				m.EXPECT().GaugeStorage(gomock.Any(), "w", 1.5).Return(errDB)
+			},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "Update counter from body with storage failure",
+			req:  testreq{url: "/update/", method: http.MethodPost, body: `{"id":"q","type":"counter","delta":2}`},
+			expect: func(m *mocks.MockMStorage) {
+				m.EXPECT().CountStorage(gomock.Any(), "q", int64(2)).Return(nil)
+				m.EXPECT().GetCount(gomock.Any(), "q").Return(int64(0), errDB)
+			},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name:   "Update gauge from body without value",
+			req:    testreq{url: "/update/", method: http.MethodPost, body: `{"id":"w","type":"gauge"}`},
+			expect: func(m *mocks.MockMStorage) {},
+			want:   http.StatusBadRequest,
+		},
+		{
+			name: "Update batch with storage failure",
+			req:  testreq{url: "/updates/", method: http.MethodPost, body: `[{"id":"w","type":"gauge","value":1}]`},
+			expect: func(m *mocks.MockMStorage) {
+				m.EXPECT().UpdateBatch(gomock.Any(), gomock.Any()).Return(errDB)
+			},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "Update batch with invalid metric",
+			req:  testreq{url: "/updates/", method: http.MethodPost, body: `[{"id":"w","type":"gauge"}]`},
+			expect: func(m *mocks.MockMStorage) {
+				m.EXPECT().UpdateBatch(gomock.Any(), gomock.Any()).Return(fmt.Errorf("%w: empty gauge value", storage.ErrInvalidMetric))
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "Get gauge not found",
+			req:  testreq{url: "/value/gauge/w/", method: http.MethodGet},
+			expect: func(m *mocks.MockMStorage) {
+				m.EXPECT().GetGauge(gomock.Any(), "w").Return(0.0, storage.ErrNotFound)
+			},
+			want: http.StatusNotFound,
+		},
+		{
+			name: "Get counter with storage failure",
+			req:  testreq{url: "/value/counter/q/", method: http.MethodGet},
+			expect: func(m *mocks.MockMStorage) {
+				m.EXPECT().GetCount(gomock.Any(), "q").Return(int64(0), errDB)
+			},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "Get from body with storage failure",
+			req:  testreq{url: "/value/", method: http.MethodPost, body: `{"id":"w","type":"gauge"}`},
+			expect: func(m *mocks.MockMStorage) {
+				m.EXPECT().GetGauge(gomock.Any(), "w").Return(0.0, errDB)
+			},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name: "Print metrics with storage failure",
+			req:  testreq{url: "/", method: http.MethodGet},
+			expect: func(m *mocks.MockMStorage) {
+				m.EXPECT().GetStorage(gomock.Any()).Return(storage.Snapshot{}, errDB)
+			},
+			want: http.StatusInternalServerError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			m := mocks.NewMockMStorage(ctrl)
+			test.expect(m)
+
+			w := httptest.NewRecorder()
+			_, r := gin.CreateTestContext(w)
+			r.POST("/update/:type/:name/:value", func(c *gin.Context) {
+				updateMetrics(c, m, false, "")
+			})
+			r.POST("/update/", func(c *gin.Context) {
+				updateMetricsFromBody(c, m, false, "", "")
+			})
+			r.POST("/updates/", func(c *gin.Context) {
+				updateBatchMetricsFromBody(c, m, false, "", "")
+			})
+			r.GET("/value/:type/:name/", func(c *gin.Context) {
+				getMetric(c, m)
+			})
+			r.POST("/value/", func(c *gin.Context) {
+				getMetricFromBody(c, m, "")
+			})
+			r.GET("/", func(c *gin.Context) {
+				printMetrics(c, m)
+			})
+			req, _ := http.NewRequest(test.req.method, test.req.url, bytes.NewBufferString(test.req.body))
+			r.ServeHTTP(w, req)
+			assert.Equal(t, test.want, w.Code)
+		})
+	}
+}
@@ -14,38 +14,32 @@ import (
 )
 
 func Example_updateMetrics() {
-	m := storage.MemStorage{
-		Gauge:   make(map[string]float64),
-		Counter: make(map[string]int64),
-	}
+	m := &storage.MemStorage{}
 	c, _ := gin.CreateTestContext(httptest.NewRecorder())
 	c.Params = []gin.Param{
 		{Key: "type", Value: "gauge"},
 		{Key: "name", Value: "test"},
 		{Key: "value", Value: "10.5"},
 	}
-	updateMetrics(c, &m, false, "testFilePath")
+	updateMetrics(c, m, false, "testFilePath")
 
 	c.Params = []gin.Param{
 		{Key: "type", Value: "counter"},
 		{Key: "name", Value: "test_counter"},
 		{Key: "value", Value: "5"},
 	}
-	updateMetrics(c, &m, false, "testFilePath")
+	updateMetrics(c, m, false, "testFilePath")
 
 	c.Params = []gin.Param{
 		{Key: "type", Value: "invalid_type"},
 	}
 
-	updateMetrics(c, &m, false, "testFilePath")
+	updateMetrics(c, m, false, "testFilePath")
 	// Output:
 }
 
 func Example_updateMetricsFromBody() {
-	m := storage.MemStorage{
-		Gauge:   make(map[string]float64),
-		Counter: make(map[string]int64),
-	}
+	m := &storage.MemStorage{}
 	c, _ := gin.CreateTestContext(httptest.NewRecorder())
 	bodyData := `{"MType": "gauge", "ID": "test", "Value": 10.5}`
 	r := strings.NewReader(bodyData)
@@ -62,22 +56,19 @@ func Example_updateMetricsFromBody() {
 	req.Header.Set("Content-Encoding", "gzip")
 	req.Body = io.NopCloser(&buf)
 	c.Request = req
-	updateMetricsFromBody(c, &m, false, "testFilePath", "hashKey")
+	updateMetricsFromBody(c, m, false, "testFilePath", "hashKey")
 
 	bodyData = `{"MType": "counter", "ID": "test_counter", "Delta": 5}`
 	r = strings.NewReader(bodyData)
 	req, _ = http.NewRequest("POST", "/", r)
 	req.Header.Set("Content-Type", "application/json")
 	c.Request = req
-	updateMetricsFromBody(c, &m, false, "testFilePath", "hashKey")
+	updateMetricsFromBody(c, m, false, "testFilePath", "hashKey")
 	// Output:
 }
 
 func Example_updateBatchMetricsFromBody() {
-	m := storage.MemStorage{
-		Gauge:   make(map[string]float64),
-		Counter: make(map[string]int64),
-	}
+	m := &storage.MemStorage{}
 	c, _ := gin.CreateTestContext(httptest.NewRecorder())
 	var v = 10.5
 	var d int64 = 5
@@ -91,16 +82,13 @@ func Example_updateBatchMetricsFromBody() {
 	req.Header.Set("Content-Type", "application/json")
 	c.Request = req
 
-	updateBatchMetricsFromBody(c, &m, false, "testFilePath", "hashKey")
+	updateBatchMetricsFromBody(c, m, false, "testFilePath", "hashKey")
 
 	// Output:
 }
 
 func Example_getMetric() {
-	m := storage.MemStorage{
-		Gauge:   make(map[string]float64),
-		Counter: make(map[string]int64),
-	}
+	m := &storage.MemStorage{}
 	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
 	m.GaugeStorage(ctx, "test_gauge", 10.5)
 	m.CountStorage(ctx, "test_counter", 5)
@@ -110,32 +98,29 @@ func Example_getMetric() {
 		{Key: "type", Value: config.Counter},
 		{Key: "name", Value: "test_counter"},
 	}
-	getMetric(c, &m)
+	getMetric(c, m)
 	c.Params = []gin.Param{
 		{Key: "type", Value: config.Gauge},
 		{Key: "name", Value: "test_gauge"},
 	}
-	getMetric(c, &m)
+	getMetric(c, m)
 
 	c.Params = []gin.Param{
 		{Key: "type", Value: "invalid_type"},
 	}
-	getMetric(c, &m)
+	getMetric(c, m)
 
 	c.Params = []gin.Param{
 		{Key: "type", Value: config.Counter},
 		{Key: "name", Value: "nonexistent_metric"},
 	}
-	getMetric(c, &m)
+	getMetric(c, m)
 
 	// Output:
 }
 
 func Example_getMetricFromBody() {
-	m := storage.MemStorage{
-		Gauge:   make(map[string]float64),
-		Counter: make(map[string]int64),
-	}
+	m := &storage.MemStorage{}
 	c, _ := gin.CreateTestContext(httptest.NewRecorder())
 	bodyData := `{"MType": "counter", "ID": "test_counter"}`
 	r := bytes.NewReader([]byte(bodyData))
@@ -152,7 +137,7 @@ func Example_getMetricFromBody() {
 	req.Header.Set("Content-Encoding", "gzip")
 	req.Body = io.NopCloser(&buf)
 	c.Request = req
-	getMetricFromBody(c, &m, "hashKey")
+	getMetricFromBody(c, m, "hashKey")
 
 	bodyData = `{"MType": "gauge", "ID": "test_gauge"}`
 	r = bytes.NewReader([]byte(bodyData))
@@ -160,7 +145,7 @@ func Example_getMetricFromBody() {
 	req.Header.Set("Content-Type", "application/json")
 	c.Request = req
 
-	getMetricFromBody(c, &m, "hashKey")
+	getMetricFromBody(c, m, "hashKey")
 
 	bodyData = `{"MType": "invalid_type"}`
 	r = bytes.NewReader([]byte(bodyData))
@@ -168,15 +153,12 @@ func Example_getMetricFromBody() {
 	req.Header.Set("Content-Type", "application/json")
 	c.Request = req
 
-	getMetricFromBody(c, &m, "hashKey")
+	getMetricFromBody(c, m, "hashKey")
 
 	// Output:
 }
 func Example_printMetrics() {
-	m := storage.MemStorage{
-		Gauge:   make(map[string]float64),
-		Counter: make(map[string]int64),
-	}
+	m := &storage.MemStorage{}
 	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
 	m.GaugeStorage(ctx, "test_gauge", 10.5)
 	m.CountStorage(ctx, "test_counter", 5)
@@ -184,7 +166,7 @@ func Example_printMetrics() {
 
 	c.Request, _ = http.NewRequest("GET", "/", nil)
 	c.Request.Header.Set("Accept-Encoding", "")
-	printMetrics(c, &m)
+	printMetrics(c, m)
 
 	// Output:
 }
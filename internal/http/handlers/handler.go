@@ -5,10 +5,10 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/rsa"
-	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"github.com/Nchezhegova/metrics-alerts/internal/alerting"
 	"github.com/Nchezhegova/metrics-alerts/internal/config"
 	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
 	"github.com/Nchezhegova/metrics-alerts/internal/http/middleware"
@@ -22,18 +22,16 @@ import (
 	"os/signal"
 	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 )
 
-var mu sync.Mutex
-
 // updateMetrics updates one metric from url params
 func updateMetrics(c *gin.Context, m storage.MStorage, syncWrite bool, filePath string) {
-	mu.Lock()
-	defer mu.Unlock()
-
+	if storage.ValidateID(c.Param("name")) != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
 	switch c.Param("type") {
 	case config.Gauge:
 		k := c.Param("name")
@@ -42,7 +40,10 @@ func updateMetrics(c *gin.Context, m storage.MStorage, syncWrite bool, filePath
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		m.GaugeStorage(c, k, v)
+		if err = m.GaugeStorage(c, k, v); err != nil {
+			abortWithError(c, err)
+			return
+		}
 
 	case config.Counter:
 		k := c.Param("name")
@@ -51,7 +52,10 @@ func updateMetrics(c *gin.Context, m storage.MStorage, syncWrite bool, filePath
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		m.CountStorage(c, k, v)
+		if err = m.CountStorage(c, k, v); err != nil {
+			abortWithError(c, err)
+			return
+		}
 	default:
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
@@ -64,9 +68,6 @@ func updateMetrics(c *gin.Context, m storage.MStorage, syncWrite bool, filePath
 
 // updateMetricsFromBody updates one metric from body
 func updateMetricsFromBody(c *gin.Context, m storage.MStorage, syncWrite bool, filePath string, hashKey string) {
-	mu.Lock()
-	defer mu.Unlock()
-
 	var metrics storage.Metrics
 	var b io.ReadCloser
 
@@ -86,26 +87,40 @@ func updateMetricsFromBody(c *gin.Context, m storage.MStorage, syncWrite bool, f
 
 	decoder := json.NewDecoder(b)
 	err := decoder.Decode(&metrics)
-	if err != nil {
+	if err != nil || metrics.Validate() != nil {
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
+	k := metrics.Key()
 	switch metrics.MType {
 	case config.Gauge:
-		k := metrics.ID
-		v := metrics.Value
-		m.GaugeStorage(c, k, *v)
+		err = m.GaugeStorage(c, k, *metrics.Value)
 
 	case config.Counter:
-		k := metrics.ID
-		v := metrics.Delta
-		m.CountStorage(c, k, *v)
-		vNew, _ := m.GetCount(c, metrics.ID)
-		metrics.Delta = &vNew
+		if source := c.GetHeader(storage.SourceHeader); source != "" {
+			// накопленное значение агента, хранилище вернет итог счетчика
+			list := []storage.Metrics{metrics}
+			if err = m.UpdateFromSource(c, source, list); err == nil {
+				metrics.Delta = list[0].Delta
+			}
+			break
+		}
+		if err = m.CountStorage(c, k, *metrics.Delta); err == nil {
+			var vNew int64
+			vNew, err = m.GetCount(c, k)
+			metrics.Delta = &vNew
+		}
 
-	default:
-		c.AbortWithStatus(http.StatusBadRequest)
+	case config.Histogram:
+		if err = m.HistogramStorage(c, k, *metrics.Histogram); err == nil {
+			var hNew storage.Histogram
+			hNew, err = m.GetHistogram(c, k)
+			metrics.Histogram = &hNew
+		}
+	}
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
 	metricsByte, err := json.Marshal(metrics)
@@ -136,9 +151,6 @@ func updateMetricsFromBody(c *gin.Context, m storage.MStorage, syncWrite bool, f
 
 // updateBatchMetricsFromBody updates a batch of metrics from the body
 func updateBatchMetricsFromBody(c *gin.Context, m storage.MStorage, syncWrite bool, filePath string, hashKey string) {
-	mu.Lock()
-	defer mu.Unlock()
-
 	var metricsList []storage.Metrics
 	var b io.ReadCloser
 
@@ -163,9 +175,9 @@ func updateBatchMetricsFromBody(c *gin.Context, m storage.MStorage, syncWrite bo
 		return
 	}
 
-	err = m.UpdateBatch(c, metricsList)
+	err = storage.UpdateReported(c, m, c.GetHeader(storage.SourceHeader), metricsList)
 	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
+		abortWithError(c, err)
 		return
 	}
 	metricsByte, err := json.Marshal(metricsList)
@@ -194,25 +206,50 @@ func updateBatchMetricsFromBody(c *gin.Context, m storage.MStorage, syncWrite bo
 	}
 }
 
-// getMetric displays the value by the key that came in the url
+// getMetric displays the value by the key that came in the url,
+// the match query params select one of the labelled series of the metric
 func getMetric(c *gin.Context, m storage.MStorage) {
+	matchers, err := parseMatchers(c)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	key := c.Param("name")
+	if len(matchers) > 0 {
+		key, err = findSeries(c, m, c.Param("type"), key, matchers)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+	}
+
 	switch c.Param("type") {
 	case config.Counter:
-		v, exists := m.GetCount(c, c.Param("name"))
-		if exists {
-			c.JSON(http.StatusOK, v)
-		} else {
-			c.AbortWithStatus(http.StatusNotFound)
+		v, err := m.GetCount(c, key)
+		if err != nil {
+			abortWithError(c, err)
 			return
 		}
+		c.JSON(http.StatusOK, v)
 	case config.Gauge:
-		v, exists := m.GetGauge(c, c.Param("name"))
-		if exists {
-			c.JSON(http.StatusOK, v)
-		} else {
-			c.AbortWithStatus(http.StatusNotFound)
+		v, err := m.GetGauge(c, key)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, v)
+	case config.Histogram:
+		qs, err := parseQuantiles(c)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
+		v, err := m.GetHistogram(c, key)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, v.WithQuantiles(qs))
 	default:
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
@@ -237,21 +274,33 @@ func getMetricFromBody(c *gin.Context, m storage.MStorage, hashKey string) {
 
 	switch metrics.MType {
 	case config.Counter:
-		v, exists := m.GetCount(c, metrics.ID)
-		if exists {
-			metrics.Delta = &v
-		} else {
-			c.AbortWithStatus(http.StatusNotFound)
+		v, err := m.GetCount(c, metrics.Key())
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		rate, err := rateOf(c, m, metrics.Key(), defaultRateWindow)
+		if err != nil {
+			abortWithError(c, err)
 			return
 		}
+		metrics.Delta = &v
+		metrics.Rate = &rate
 	case config.Gauge:
-		v, exists := m.GetGauge(c, metrics.ID)
-		if exists {
-			metrics.Value = &v
-		} else {
-			c.AbortWithStatus(http.StatusNotFound)
+		v, err := m.GetGauge(c, metrics.Key())
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		metrics.Value = &v
+	case config.Histogram:
+		v, err := m.GetHistogram(c, metrics.Key())
+		if err != nil {
+			abortWithError(c, err)
 			return
 		}
+		v = v.WithQuantiles(storage.DefaultQuantiles)
+		metrics.Histogram = &v
 	default:
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
@@ -278,51 +327,105 @@ func getMetricFromBody(c *gin.Context, m storage.MStorage, hashKey string) {
 	}
 }
 
-// printMetrics prints all metrics
+// printMetrics prints all metrics or only the series selected by the match query params.
+// The list is filtered by the name prefix, sorted and paged by the query params, see parseListOptions.
+// The response is JSON, the clients that prefer HTML like browsers get the dashboard page.
 func printMetrics(c *gin.Context, m storage.MStorage) {
-	res := m.GetStorage(c)
-	metricsByte, err := json.Marshal(res)
+	format := listFormat(c.GetHeader("Accept"))
+	matchers, err := parseMatchers(c)
 	if err != nil {
-		log.Logger.Info("Error convert to JSON:", zap.Error(err))
+		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
-		var compressBody bytes.Buffer
-		gzipWriter := gzip.NewWriter(&compressBody)
-
-		_, err = gzipWriter.Write(metricsByte)
-		if err != nil {
-			log.Logger.Info("Error convert to gzip.Writer:", zap.Error(err))
-			return
-		}
-
-		err = gzipWriter.Close()
-		if err != nil {
-			log.Logger.Info("Error closing compressed:", zap.Error(err))
-			return
+	opts, err := parseListOptions(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	refresh, err := parseRefresh(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	metrics, err := storage.ListMetrics(c, m)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if len(matchers) > 0 {
+		selected := make([]storage.Metrics, 0, len(metrics))
+		for _, metric := range metrics {
+			if storage.MatchSeries(matchers, metric.ID, metric.Labels) {
+				selected = append(selected, metric)
+			}
 		}
+		metrics = selected
+	}
+	if format == gin.MIMEHTML {
+		metrics = dashboardMetrics(metrics)
+	}
+	metrics, total := opts.apply(metrics)
 
-		compressedData := compressBody.String()
+	var body []byte
+	contentType := "application/json"
+	if format == gin.MIMEHTML {
+		contentType = "text/html; charset=utf-8"
+		body, err = renderDashboard(c, metrics, total, opts, refresh)
+	} else {
+		body, err = json.Marshal(metrics)
+	}
+	if err != nil {
+		log.Logger.Info("Error render metrics:", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header(totalCountHeader, strconv.Itoa(total))
+	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		compressBody := helpers.CompressResp(body)
 		c.Header("Content-Encoding", "gzip")
-		c.Header("Content-Type", "text/html")
-
-		c.Data(http.StatusOK, "text/html", []byte(compressedData))
+		c.Data(http.StatusOK, contentType, compressBody.Bytes())
+		return
 	}
-	c.String(http.StatusOK, string(metricsByte))
+	c.Data(http.StatusOK, contentType, body)
 }
 
-// checkDB checks DB connection
-func checkDB(c *gin.Context, db *sql.DB) {
-	if db != nil {
-		err := storage.CheckConnect(db)
-		if err != nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
-			return
+// listFormat returns JSON when the Accept header prefers application/json over text/html and the wildcards,
+// the dashboard is returned otherwise, e.g. for an empty or unknown Accept
+func listFormat(accept string) string {
+	jsonQ, htmlQ, wildcardQ := 0.0, 0.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && name == "q" {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
 		}
-		c.Status(http.StatusOK)
-	} else {
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case gin.MIMEJSON:
+			jsonQ = max(jsonQ, q)
+		case gin.MIMEHTML:
+			htmlQ = max(htmlQ, q)
+		case "*/*", "text/*", "application/*":
+			wildcardQ = max(wildcardQ, q)
+		}
+	}
+	if jsonQ > htmlQ && jsonQ >= wildcardQ {
+		return gin.MIMEJSON
+	}
+	return gin.MIMEHTML
+}
+
+// ping checks that the storage is available
+func ping(c *gin.Context, m storage.MStorage) {
+	if err := m.Ping(c); err != nil {
+		log.Logger.Info("Error storage ping:", zap.Error(err))
 		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
+	c.Status(http.StatusOK)
 }
 
 // checkHash checks hash-key from request
@@ -350,14 +453,22 @@ func checkHash(c *gin.Context, hashKey string) bool {
 	return true
 }
 
-// StartServ starts the server and routes requests
-func StartServ(m storage.MStorage, addr string, storeInterval int, filePath string, restore bool, hashKey string, keyPath string) {
+// StartServ starts the server and routes requests, the storage is restored before by helpers.RestoreStorage.
+// GET /stream is served when the stream is not nil
+func StartServ(m storage.MStorage, addr string, persistence helpers.Persistence, hashKey string, keyPath string, engine *alerting.Engine, metricTTL time.Duration, stream *storage.Stream) {
 	r := gin.Default()
 	r.ContextWithFallback = true
 
 	r.Use(log.GinLogger(log.Logger), gin.Recovery())
 
-	syncWrite := helpers.SetWriterFile(m, storeInterval, filePath, restore)
+	syncWrite, filePath, walStorage := persistence.SyncWrite, persistence.FilePath, persistence.WAL
+
+	if engine != nil && engine.Interval > 0 {
+		go evaluateAlerts(engine, m)
+	}
+	if metricTTL > 0 {
+		go expireMetrics(m, metricTTL, syncWrite, filePath)
+	}
 
 	var key *rsa.PrivateKey
 	var err error
@@ -375,6 +486,9 @@ func StartServ(m storage.MStorage, addr string, storeInterval int, filePath stri
 	r.GET("/value/:type/:name/", func(c *gin.Context) {
 		getMetric(c, m)
 	})
+	r.DELETE("/value/:type/:name", func(c *gin.Context) {
+		deleteMetric(c, m, syncWrite, filePath)
+	})
 	r.POST("/value/", func(c *gin.Context) {
 		if checkHash(c, hashKey) {
 			getMetricFromBody(c, m, hashKey)
@@ -386,7 +500,40 @@ func StartServ(m storage.MStorage, addr string, storeInterval int, filePath stri
 		printMetrics(c, m)
 	})
 	r.GET("/ping", func(c *gin.Context) {
-		checkDB(c, storage.DB)
+		ping(c, m)
+	})
+	r.GET("/rate/", func(c *gin.Context) {
+		getRates(c, m)
+	})
+	if stream != nil {
+		r.GET("/stream", func(c *gin.Context) {
+			streamMetrics(c, stream)
+		})
+	}
+	r.GET("/metrics", func(c *gin.Context) {
+		printPrometheus(c, m)
+	})
+	r.POST("/api/v1/write", func(c *gin.Context) {
+		if checkHash(c, hashKey) {
+			remoteWrite(c, m, syncWrite, filePath)
+		} else {
+			log.Logger.Info("Problem with hashkey")
+		}
+	})
+	r.GET("/query_range", func(c *gin.Context) {
+		queryRange(c, m)
+	})
+	r.GET("/alerts", func(c *gin.Context) {
+		getAlerts(c, engine)
+	})
+	r.POST("/silences", func(c *gin.Context) {
+		addSilence(c, m, syncWrite, filePath)
+	})
+	r.GET("/silences", func(c *gin.Context) {
+		getSilences(c, m)
+	})
+	r.DELETE("/silences/:id", func(c *gin.Context) {
+		deleteSilence(c, m, syncWrite, filePath)
 	})
 
 	r.Use(middleware.DecryptBody(key))
@@ -398,6 +545,13 @@ func StartServ(m storage.MStorage, addr string, storeInterval int, filePath stri
 				log.Logger.Info("Problem with hashkey")
 			}
 		})
+		r.POST("/delete/", func(c *gin.Context) {
+			if checkHash(c, hashKey) {
+				deleteMetricsFromBody(c, m, syncWrite, filePath)
+			} else {
+				log.Logger.Info("Problem with hashkey")
+			}
+		})
 		r.POST("/update/", func(c *gin.Context) {
 			if checkHash(c, hashKey) {
 				updateMetricsFromBody(c, m, syncWrite, filePath, hashKey)
@@ -411,21 +565,36 @@ func StartServ(m storage.MStorage, addr string, storeInterval int, filePath stri
 		Addr:    addr,
 		Handler: r,
 	}
+	if stream != nil {
+		// Shutdown ждет завершения запросов, закрытие потока отключает подписчиков
+		server.RegisterOnShutdown(stream.Close)
+	}
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
+	shutdown := make(chan struct{})
 	go func() {
+		defer close(shutdown)
 		<-sigint
 		log.Logger.Info("Shutting down the server...")
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		if err = server.Shutdown(ctx); err != nil {
+		if err := server.Shutdown(ctx); err != nil {
 			log.Logger.Error("Error shutting down the server:", zap.Error(err))
 		}
 	}()
 	if err = server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Logger.Error("Error starting the server:", zap.Error(err))
+		return
+	}
+	// ListenAndServe возвращается сразу, запросы еще завершаются
+	<-shutdown
+	if walStorage != nil {
+		// последнее сжатие, следующий запуск начнет со свежего снапшота
+		if err = helpers.CompactWAL(walStorage, filePath); err != nil {
+			log.Logger.Error("Error compacting the WAL:", zap.Error(err))
+		}
 	}
 }
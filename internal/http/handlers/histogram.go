@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+)
+
+// parseQuantiles parses the comma separated q query param, the default quantiles are used without it
+func parseQuantiles(c *gin.Context) ([]float64, error) {
+	param := c.Query("q")
+	if param == "" {
+		return storage.DefaultQuantiles, nil
+	}
+	var qs []float64
+	for _, s := range strings.Split(param, ",") {
+		q, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, fmt.Errorf("invalid quantile %q", s)
+		}
+		qs = append(qs, q)
+	}
+	return qs, nil
+}
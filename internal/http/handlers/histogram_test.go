@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func Test_updateHistogramFromBody(t *testing.T) {
+	ms := &storage.MemStorage{}
+	body := `{"id":"latency","type":"histogram","histogram":{"buckets":[1,2,4],"counts":[2,2,4,0],"sum":20,"count":8}}`
+
+	_, _, w := createContext(testreq{url: "/update/", method: http.MethodPost, body: body}, ms)
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, _, w = createContext(testreq{url: "/updates/", method: http.MethodPost, body: "[" + body + "]"}, ms)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []uint64{4, 4, 8, 0}, ms.Snapshot().Histograms["latency"].Counts)
+
+	_, _, w = createContext(testreq{url: "/value/histogram/latency/?q=0.75", method: http.MethodGet}, ms)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var h storage.Histogram
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &h))
+	assert.Equal(t, uint64(16), h.Count)
+	assert.Equal(t, map[string]float64{"0.75": 3}, h.Quantiles)
+
+	_, _, w = createContext(testreq{url: "/value/", method: http.MethodPost, body: `{"id":"latency","type":"histogram"}`}, ms)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var metrics storage.Metrics
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &metrics))
+	assert.Len(t, metrics.Histogram.Quantiles, 3)
+	assert.InDelta(t, 2, metrics.Histogram.Quantiles["0.5"], 1e-9)
+	assert.InDelta(t, 3.6, metrics.Histogram.Quantiles["0.9"], 1e-9)
+	assert.InDelta(t, 3.96, metrics.Histogram.Quantiles["0.99"], 1e-9)
+}
+
+func Test_updateHistogramInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		req  testreq
+		want int
+	}{
+		{name: "without histogram", req: testreq{url: "/update/", method: http.MethodPost, body: `{"id":"latency","type":"histogram"}`}, want: http.StatusBadRequest},
+		{name: "count mismatch", req: testreq{url: "/update/", method: http.MethodPost, body: `{"id":"latency","type":"histogram","histogram":{"buckets":[1],"counts":[1,1],"count":1}}`}, want: http.StatusBadRequest},
+		{name: "batch", req: testreq{url: "/updates/", method: http.MethodPost, body: `[{"id":"latency","type":"histogram","histogram":{"buckets":[2,1],"counts":[0,0,0]}}]`}, want: http.StatusBadRequest},
+		{name: "invalid quantile", req: testreq{url: "/value/histogram/latency/?q=2", method: http.MethodGet}, want: http.StatusBadRequest},
+		{name: "not found", req: testreq{url: "/value/histogram/unknown/", method: http.MethodGet}, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := storage.NewMemStorage(storage.Snapshot{
+				Gauge:      make(map[string]float64),
+				Counter:    make(map[string]int64),
+				Histograms: map[string]storage.Histogram{"latency": storage.NewHistogram(nil)},
+			})
+			_, _, w := createContext(tt.req, ms)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// parseMatchers parses the label matchers from the match query params, e.g. ?match=host=web1&match=env!=dev
+func parseMatchers(c *gin.Context) ([]storage.Matcher, error) {
+	var matchers []storage.Matcher
+	for _, s := range c.QueryArray("match") {
+		matcher, err := storage.ParseMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+// findSeries returns the key of the only series of the metric that satisfies the matchers.
+// The error is storage.ErrNotFound when nothing matches and errBadRequest when the matchers select several series.
+func findSeries(c *gin.Context, m storage.MStorage, mtype string, name string, matchers []storage.Matcher) (string, error) {
+	var keys []string
+	switch mtype {
+	case config.Gauge:
+		gauges, _, err := storage.Select(c, m, matchers)
+		if err != nil {
+			return "", err
+		}
+		for key := range gauges {
+			keys = append(keys, key)
+		}
+	case config.Counter:
+		_, counters, err := storage.Select(c, m, matchers)
+		if err != nil {
+			return "", err
+		}
+		for key := range counters {
+			keys = append(keys, key)
+		}
+	case config.Histogram:
+		histograms, err := storage.SelectHistograms(c, m, matchers)
+		if err != nil {
+			return "", err
+		}
+		for key := range histograms {
+			keys = append(keys, key)
+		}
+	default:
+		return "", fmt.Errorf("%w: unknowning metric type", errBadRequest)
+	}
+
+	var found []string
+	for _, key := range keys {
+		if id, _ := storage.ParseMetricKey(key); id == name {
+			found = append(found, key)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", storage.ErrNotFound
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("%w: several series of %s match", errBadRequest, name)
+}
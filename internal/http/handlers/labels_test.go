@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func labelledStorage() *storage.MemStorage {
+	return storage.NewMemStorage(storage.Snapshot{
+		Gauge: map[string]float64{
+			"load":                         0.1,
+			`load{env="prod",host="web1"}`: 1,
+			`load{env="dev",host="web2"}`:  2,
+		},
+		Counter: map[string]int64{
+			`requests{host="web1"}`: 7,
+		},
+	})
+}
+
+func Test_getMetricWithMatchers(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		wantCode int
+		want     string
+	}{
+		{name: "without matchers", url: "/value/gauge/load/", wantCode: http.StatusOK, want: "0.1"},
+		{name: "one series", url: "/value/gauge/load/?match=host=web1", wantCode: http.StatusOK, want: "1"},
+		{name: "regexp", url: "/value/gauge/load/?match=env=~d.*", wantCode: http.StatusOK, want: "2"},
+		{name: "counter", url: "/value/counter/requests/?match=host=web1", wantCode: http.StatusOK, want: "7"},
+		{name: "several series", url: "/value/gauge/load/?match=host=~web.*", wantCode: http.StatusBadRequest},
+		{name: "no series", url: "/value/gauge/load/?match=host=web3", wantCode: http.StatusNotFound},
+		{name: "invalid matcher", url: "/value/gauge/load/?match=host", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := labelledStorage()
+			_, _, w := createContext(testreq{url: tt.url, method: http.MethodGet}, ms)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_printMetricsWithMatchers(t *testing.T) {
+	ms := labelledStorage()
+	_, _, w := createContext(testreq{url: "/?match=host=web1", method: http.MethodGet, accept: "application/json"}, ms)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res []storage.Metrics
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	if assert.Len(t, res, 2) {
+		assert.Equal(t, "load", res[0].ID)
+		assert.Equal(t, map[string]string{"env": "prod", "host": "web1"}, res[0].Labels)
+		assert.Equal(t, 1.0, *res[0].Value)
+		assert.Equal(t, "requests", res[1].ID)
+		assert.Equal(t, map[string]string{"host": "web1"}, res[1].Labels)
+		assert.Equal(t, int64(7), *res[1].Delta)
+	}
+}
+
+func Test_updateMetricsFromBodyWithLabels(t *testing.T) {
+	ms := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   make(map[string]float64),
+		Counter: map[string]int64{"requests": 1},
+	})
+	_, _, w := createContext(testreq{
+		url:    "/update/",
+		method: http.MethodPost,
+		body:   `{"id":"requests","type":"counter","delta":5,"labels":{"host":"web1"}}`,
+	}, ms)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"requests","type":"counter","delta":5,"labels":{"host":"web1"}}`, w.Body.String())
+	assert.Equal(t, int64(1), ms.Snapshot().Counter["requests"])
+	assert.Equal(t, int64(5), ms.Snapshot().Counter[`requests{host="web1"}`])
+
+	_, _, w = createContext(testreq{
+		url:    "/value/",
+		method: http.MethodPost,
+		body:   `{"id":"requests","type":"counter","labels":{"host":"web1"}}`,
+	}, ms)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"requests","type":"counter","delta":5,"rate":0,"labels":{"host":"web1"}}`, w.Body.String())
+
+	_, _, w = createContext(testreq{
+		url:    "/update/",
+		method: http.MethodPost,
+		body:   `{"id":"requests","type":"counter","delta":5,"labels":{"1host":"web1"}}`,
+	}, ms)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// totalCountHeader is the number of the metrics of the list before the pagination
+const totalCountHeader = "X-Total-Count"
+
+// Sort orders of the metrics list, a leading minus reverses the order
+const (
+	sortByName = "name"
+	sortByType = "type"
+)
+
+// listOptions are the query params of the metrics list
+type listOptions struct {
+	prefix string
+	sortBy string
+	desc   bool
+	limit  int // 0 - без ограничения
+	offset int
+}
+
+// parseListOptions reads the prefix, sort, limit and offset query params
+func parseListOptions(c *gin.Context) (listOptions, error) {
+	opts := listOptions{
+		prefix: c.Query("prefix"),
+		sortBy: c.DefaultQuery("sort", sortByName),
+	}
+	if strings.HasPrefix(opts.sortBy, "-") {
+		opts.desc = true
+		opts.sortBy = opts.sortBy[1:]
+	}
+	if opts.sortBy != sortByName && opts.sortBy != sortByType {
+		return listOptions{}, fmt.Errorf("%w: unknowning sort %q", errBadRequest, opts.sortBy)
+	}
+	var err error
+	if opts.limit, err = parseCount(c, "limit"); err != nil {
+		return listOptions{}, err
+	}
+	if opts.offset, err = parseCount(c, "offset"); err != nil {
+		return listOptions{}, err
+	}
+	return opts, nil
+}
+
+// parseCount parses a non-negative integer query param, a missing param is 0
+func parseCount(c *gin.Context, name string) (int, error) {
+	s := c.Query(name)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: invalid %s %q", errBadRequest, name, s)
+	}
+	return n, nil
+}
+
+// apply sorts and pages the metrics with the name prefix, total is the number of them before the pagination
+func (o listOptions) apply(metrics []storage.Metrics) (page []storage.Metrics, total int) {
+	res := make([]storage.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		if strings.HasPrefix(metric.ID, o.prefix) {
+			res = append(res, metric)
+		}
+	}
+	compare := func(a, b storage.Metrics) int {
+		if o.sortBy == sortByType && a.MType != b.MType {
+			return strings.Compare(a.MType, b.MType)
+		}
+		return storage.CompareByName(a, b)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if o.desc {
+			return compare(res[j], res[i]) < 0
+		}
+		return compare(res[i], res[j]) < 0
+	})
+
+	total = len(res)
+	if o.offset >= total {
+		return []storage.Metrics{}, total
+	}
+	res = res[o.offset:]
+	if o.limit > 0 && o.limit < len(res) {
+		res = res[:o.limit]
+	}
+	return res, total
+}
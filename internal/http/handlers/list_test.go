@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func Test_printMetricsList(t *testing.T) {
+	ms := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"Alloc": 1, "HeapAlloc": 2, "HeapSys": 3},
+		Counter: map[string]int64{"PollCount": 4, "HeapObjects": 5},
+		Histograms: map[string]storage.Histogram{
+			"latency": storage.NewHistogram([]float64{1}),
+		},
+	})
+	tests := []struct {
+		name  string
+		url   string
+		want  int
+		ids   []string
+		total string
+	}{
+		{
+			name:  "All sorted by name",
+			url:   "/",
+			want:  http.StatusOK,
+			ids:   []string{"Alloc", "HeapAlloc", "HeapObjects", "HeapSys", "PollCount", "latency"},
+			total: "6",
+		},
+		{
+			name:  "Prefix",
+			url:   "/?prefix=Heap",
+			want:  http.StatusOK,
+			ids:   []string{"HeapAlloc", "HeapObjects", "HeapSys"},
+			total: "3",
+		},
+		{
+			name:  "Sort by type descending",
+			url:   "/?sort=-type",
+			want:  http.StatusOK,
+			ids:   []string{"latency", "HeapSys", "HeapAlloc", "Alloc", "PollCount", "HeapObjects"},
+			total: "6",
+		},
+		{
+			name:  "Page",
+			url:   "/?prefix=Heap&limit=2&offset=1",
+			want:  http.StatusOK,
+			ids:   []string{"HeapObjects", "HeapSys"},
+			total: "3",
+		},
+		{
+			name:  "Offset after the end",
+			url:   "/?offset=10",
+			want:  http.StatusOK,
+			ids:   []string{},
+			total: "6",
+		},
+		{
+			name: "Unknown sort",
+			url:  "/?sort=value",
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "Negative limit",
+			url:  "/?limit=-1",
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "Invalid offset",
+			url:  "/?offset=a",
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, w := createContext(testreq{url: tt.url, method: http.MethodGet, accept: "application/json"}, ms)
+			assert.Equal(t, tt.want, w.Code)
+			if tt.want != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.total, w.Header().Get(totalCountHeader))
+			var res []storage.Metrics
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			ids := make([]string, 0, len(res))
+			for _, metric := range res {
+				ids = append(ids, metric.ID)
+			}
+			assert.Equal(t, tt.ids, ids)
+		})
+	}
+}
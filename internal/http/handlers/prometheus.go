@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	"github.com/Nchezhegova/metrics-alerts/internal/prometheus"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+// printPrometheus prints all metrics in the Prometheus text format, the match query params filter the series
+func printPrometheus(c *gin.Context, m storage.MStorage) {
+	matchers, err := parseMatchers(c)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	gauges, counters, err := storage.Select(c, m, matchers)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	histograms, err := storage.SelectHistograms(c, m, matchers)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err = prometheus.WriteText(&buf, gauges, counters, histograms); err != nil {
+		log.Logger.Info("Error writing Prometheus metrics:", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		compressBody := helpers.CompressResp(buf.Bytes())
+		c.Header("Content-Encoding", "gzip")
+		c.Data(http.StatusOK, prometheus.ContentType, compressBody.Bytes())
+		return
+	}
+	c.Data(http.StatusOK, prometheus.ContentType, buf.Bytes())
+}
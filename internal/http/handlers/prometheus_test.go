@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/Nchezhegova/metrics-alerts/internal/prometheus"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_printPrometheus(t *testing.T) {
+	ms := storage.NewMemStorage(storage.Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 36.6},
+		Counter: map[string]int64{"PollCount": 54},
+	})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/metrics", nil)
+	printPrometheus(c, ms)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, prometheus.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE HeapAlloc gauge\nHeapAlloc 36.6\n# TYPE PollCount_total counter\nPollCount_total 54\n", w.Body.String())
+}
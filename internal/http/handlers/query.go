@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	"github.com/Nchezhegova/metrics-alerts/internal/query"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxQueryPoints limits the number of steps in one range query
+const maxQueryPoints = 11000
+
+// rangeResponse is the body of the /query_range response
+type rangeResponse struct {
+	Name   string            `json:"name"`
+	MType  string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Fn     string            `json:"fn"`
+	Step   string            `json:"step"`
+	Points []storage.Sample  `json:"points"`
+}
+
+// parseTime parses RFC3339 or unix seconds, returns def for an empty string
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	whole, frac := math.Modf(sec)
+	return time.Unix(int64(whole), int64(frac*1e9)), nil
+}
+
+// parseStep parses a duration like 30s or a number of seconds
+func parseStep(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid step %q", s)
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
+
+// queryRange displays the metric history aggregated by steps
+func queryRange(c *gin.Context, m storage.MStorage) {
+	name := c.Query("name")
+	mtype := c.Query("type")
+	if name == "" || (mtype != config.Gauge && mtype != config.Counter) {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	to, err := parseTime(c.Query("to"), now)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	from, err := parseTime(c.Query("from"), to.Add(-time.Hour))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	step, err := parseStep(c.DefaultQuery("step", "60s"))
+	if err != nil || step <= 0 || to.Before(from) || to.Sub(from)/step > maxQueryPoints {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	fn := c.DefaultQuery("fn", query.FnAvg)
+	matchers, err := parseMatchers(c)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	key := name
+	if len(matchers) > 0 {
+		key, err = findSeries(c, m, mtype, name, matchers)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+	}
+
+	samples, err := m.GetRange(c, mtype, key, from, to)
+	if err != nil {
+		log.Logger.Info("Error reading history:", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	_, labels := storage.ParseMetricKey(key)
+	points, err := query.Downsample(samples, from, to, step, fn)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	c.JSON(http.StatusOK, rangeResponse{
+		Name:   name,
+		MType:  mtype,
+		Labels: labels,
+		Fn:     fn,
+		Step:   step.String(),
+		Points: points,
+	})
+}
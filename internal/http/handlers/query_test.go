@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_queryRange(t *testing.T) {
+	ms := &storage.MemStorage{}
+	ctx := context.Background()
+	from := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	ms.GaugeStorage(ctx, "HeapAlloc", 10)
+	ms.GaugeStorage(ctx, "HeapAlloc", 20)
+
+	r := gin.New()
+	r.GET("/query_range", func(c *gin.Context) {
+		queryRange(c, ms)
+	})
+
+	tests := []struct {
+		name   string
+		url    string
+		want   int
+		points []float64
+	}{
+		{
+			name:   "avg",
+			url:    "/query_range?name=HeapAlloc&type=gauge&from=" + from + "&step=5m&fn=avg",
+			want:   http.StatusOK,
+			points: []float64{15},
+		},
+		{
+			name:   "max",
+			url:    "/query_range?name=HeapAlloc&type=gauge&from=" + from + "&step=300&fn=max",
+			want:   http.StatusOK,
+			points: []float64{20},
+		},
+		{
+			name:   "unknown metric",
+			url:    "/query_range?name=Unknown&type=gauge",
+			want:   http.StatusOK,
+			points: nil,
+		},
+		{
+			name: "invalid type",
+			url:  "/query_range?name=HeapAlloc&type=histogram",
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "invalid fn",
+			url:  "/query_range?name=HeapAlloc&type=gauge&fn=median",
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "invalid step",
+			url:  "/query_range?name=HeapAlloc&type=gauge&step=abc",
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "too many points",
+			url:  "/query_range?name=HeapAlloc&type=gauge&step=1ms",
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "invalid from",
+			url:  "/query_range?name=HeapAlloc&type=gauge&from=yesterday",
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+			if tt.want != http.StatusOK {
+				return
+			}
+			var resp rangeResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			var values []float64
+			for _, p := range resp.Points {
+				values = append(values, p.Value)
+			}
+			assert.Equal(t, tt.points, values)
+		})
+	}
+}
+
+func Test_parseTime(t *testing.T) {
+	def := time.Now()
+	res, err := parseTime("", def)
+	assert.NoError(t, err)
+	assert.Equal(t, def, res)
+
+	res, err = parseTime("2024-01-01T00:00:00Z", def)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1704067200), res.Unix())
+
+	res, err = parseTime("1704067200.5", def)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1704067200500), res.UnixMilli())
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/query"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// defaultRateWindow is the history window of a counter rate when the request has no window
+const defaultRateWindow = time.Minute
+
+// counterRate is an item of the /rate/ response
+type counterRate struct {
+	ID     string            `json:"id"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Delta  int64             `json:"delta"`
+	Rate   float64           `json:"rate"`
+}
+
+// rateOf returns the per-second increase of the counter over the window, 0 when the window has less than two samples
+func rateOf(c context.Context, m storage.MStorage, key string, window time.Duration) (float64, error) {
+	now := time.Now()
+	samples, err := m.GetRange(c, config.Counter, key, now.Add(-window), now)
+	if err != nil {
+		return 0, err
+	}
+	rate, _ := query.Rate(samples)
+	return rate, nil
+}
+
+// getRates displays the totals and rates of all counters or only of the series selected by the match query params
+func getRates(c *gin.Context, m storage.MStorage) {
+	matchers, err := parseMatchers(c)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	window, err := parseStep(c.DefaultQuery("window", defaultRateWindow.String()))
+	if err != nil || window <= 0 {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	_, counters, err := storage.Select(c, m, matchers)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	keys := make([]string, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	res := make([]counterRate, 0, len(keys))
+	for _, key := range keys {
+		rate, err := rateOf(c, m, key, window)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		id, labels := storage.ParseMetricKey(key)
+		res = append(res, counterRate{ID: id, Labels: labels, Delta: counters[key], Rate: rate})
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func rateRouter(ms *storage.MemStorage) *gin.Engine {
+	r := gin.New()
+	r.POST("/update/", func(c *gin.Context) {
+		updateMetricsFromBody(c, ms, false, "", "")
+	})
+	r.POST("/updates/", func(c *gin.Context) {
+		updateBatchMetricsFromBody(c, ms, false, "", "")
+	})
+	r.POST("/value/", func(c *gin.Context) {
+		getMetricFromBody(c, ms, "")
+	})
+	r.GET("/rate/", func(c *gin.Context) {
+		getRates(c, ms)
+	})
+	return r
+}
+
+func Test_counterSources(t *testing.T) {
+	ms := &storage.MemStorage{}
+	r := rateRouter(ms)
+	send := func(url string, body string, source string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(body))
+		if source != "" {
+			req.Header.Set(storage.SourceHeader, source)
+		}
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	send("/update/", `{"id":"PollCount","type":"counter","delta":5}`, "agent1")
+	send("/update/", `{"id":"PollCount","type":"counter","delta":8}`, "agent1")
+	assert.Equal(t, int64(8), ms.Snapshot().Counter["PollCount"])
+
+	// агент перезапустился и считает заново
+	send("/updates/", `[{"id":"PollCount","type":"counter","delta":2}]`, "agent1")
+	assert.Equal(t, int64(10), ms.Snapshot().Counter["PollCount"])
+
+	send("/update/", `{"id":"PollCount","type":"counter","delta":3}`, "")
+	assert.Equal(t, int64(13), ms.Snapshot().Counter["PollCount"])
+}
+
+func Test_getRates(t *testing.T) {
+	ms := &storage.MemStorage{HistorySize: 10}
+	ctx := context.Background()
+	labels := map[string]string{"host": "web1"}
+	assert.NoError(t, ms.CountStorage(ctx, "PollCount", 1))
+	assert.NoError(t, ms.CountStorage(ctx, storage.MetricKey("PollCount", labels), 1))
+	assert.NoError(t, ms.GaugeStorage(ctx, "Alloc", 1))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, ms.CountStorage(ctx, "PollCount", 5))
+	r := rateRouter(ms)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/rate/", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rates []counterRate
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rates))
+	assert.Len(t, rates, 2)
+	assert.Equal(t, "PollCount", rates[0].ID)
+	assert.Equal(t, int64(6), rates[0].Delta)
+	assert.Greater(t, rates[0].Rate, 0.0)
+	assert.Less(t, rates[0].Rate, 5/0.05)
+	assert.Equal(t, labels, rates[1].Labels)
+	assert.Equal(t, 0.0, rates[1].Rate, "Expected no rate for a single sample")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/rate/?match=host%3Dweb1", nil)
+	r.ServeHTTP(w, req)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rates))
+	assert.Len(t, rates, 1)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/rate/?window=0", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/value/", bytes.NewBufferString(`{"id":"PollCount","type":"counter"}`))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var metric storage.Metrics
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &metric))
+	assert.Equal(t, int64(6), *metric.Delta)
+	if assert.NotNil(t, metric.Rate) {
+		assert.Greater(t, *metric.Rate, 0.0)
+	}
+}
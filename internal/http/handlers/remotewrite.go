@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/prometheus"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// remoteSourcePrefix starts the source id of a remote_write sender that does not set storage.SourceHeader
+const remoteSourcePrefix = "remote_write@"
+
+// remoteSource returns the id of the sender, Prometheus sends its counters as cumulative values.
+// The header can be set with the headers option of remote_write, otherwise the client address is used.
+func remoteSource(c *gin.Context) string {
+	if source := c.GetHeader(storage.SourceHeader); source != "" {
+		return source
+	}
+	return remoteSourcePrefix + c.ClientIP()
+}
+
+// remoteWrite stores samples from a Prometheus remote_write request.
+// Series with the _total suffix are stored as counters without the suffix, counters are integer,
+// so a fractional value like process_cpu_seconds_total is rounded to the nearest integer
+// and its rate changes in whole steps.
+func remoteWrite(c *gin.Context, m storage.MStorage, syncWrite bool, filePath string) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	series, err := prometheus.DecodeWriteRequest(body)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	metricsList := make([]storage.Metrics, 0, len(series))
+	for _, ts := range series {
+		name := ts.Name()
+		sample, ok := ts.Latest()
+		if name == "" || !ok || math.IsNaN(sample.Value) {
+			continue
+		}
+		labels := ts.LabelMap()
+		if storage.ValidateID(name) != nil || storage.ValidateLabels(labels) != nil {
+			continue
+		}
+		if strings.HasSuffix(name, prometheus.CounterSuffix) {
+			// накопленное значение, хранилище заменит его на прирост от прошлого значения источника;
+			// дробная часть теряется, счетчики хранятся целыми
+			total := int64(math.Round(sample.Value))
+			name = strings.TrimSuffix(name, prometheus.CounterSuffix)
+			metricsList = append(metricsList, storage.Metrics{ID: name, MType: config.Counter, Delta: &total, Labels: labels})
+			continue
+		}
+		value := sample.Value
+		metricsList = append(metricsList, storage.Metrics{ID: name, MType: config.Gauge, Value: &value, Labels: labels})
+	}
+
+	if err = m.UpdateFromSource(c, remoteSource(c), metricsList); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if syncWrite {
+		helpers.WriteFile(m, filePath)
+	}
+	c.Status(http.StatusNoContent)
+}
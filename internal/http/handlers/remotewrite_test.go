@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/prometheus"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func remoteWriteRouter(ms *storage.MemStorage, hashKey string) *gin.Engine {
+	r := gin.New()
+	r.POST("/api/v1/write", func(c *gin.Context) {
+		if checkHash(c, hashKey) {
+			remoteWrite(c, ms, false, "")
+		}
+	})
+	return r
+}
+
+func remoteWriteBody(name string, values ...float64) []byte {
+	ts := prometheus.TimeSeries{Labels: []prometheus.Label{{Name: prometheus.NameLabel, Value: name}}}
+	for i, v := range values {
+		ts.Samples = append(ts.Samples, prometheus.Sample{Value: v, Timestamp: int64(i)})
+	}
+	return prometheus.EncodeWriteRequest([]prometheus.TimeSeries{ts})
+}
+
+func Test_remoteWrite(t *testing.T) {
+	ms := &storage.MemStorage{}
+	r := remoteWriteRouter(ms, "")
+	send := func(body []byte, source ...string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+		if len(source) > 0 {
+			req.Header.Set(storage.SourceHeader, source[0])
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, send(remoteWriteBody("HeapAlloc", 1, 2)))
+	assert.Equal(t, 2.0, ms.Snapshot().Gauge["HeapAlloc"])
+
+	assert.Equal(t, http.StatusNoContent, send(remoteWriteBody("requests_total", 10)))
+	assert.Equal(t, int64(10), ms.Snapshot().Counter["requests"])
+	assert.Equal(t, http.StatusNoContent, send(remoteWriteBody("requests_total", 15)))
+	assert.Equal(t, int64(15), ms.Snapshot().Counter["requests"])
+	// сброс счётчика на стороне Prometheus
+	assert.Equal(t, http.StatusNoContent, send(remoteWriteBody("requests_total", 3)))
+	assert.Equal(t, int64(18), ms.Snapshot().Counter["requests"])
+	// другой Prometheus со своим накопленным значением
+	assert.Equal(t, http.StatusNoContent, send(remoteWriteBody("requests_total", 5), "prometheus-2"))
+	assert.Equal(t, int64(23), ms.Snapshot().Counter["requests"])
+	assert.Equal(t, http.StatusNoContent, send(remoteWriteBody("requests_total", 4)))
+	assert.Equal(t, int64(24), ms.Snapshot().Counter["requests"])
+
+	// дробные счетчики округляются до целого
+	assert.Equal(t, http.StatusNoContent, send(remoteWriteBody("process_cpu_seconds_total", 2.6)))
+	assert.Equal(t, int64(3), ms.Snapshot().Counter["process_cpu_seconds"])
+
+	assert.Equal(t, http.StatusBadRequest, send([]byte("invalid")))
+}
+
+func Test_remoteWriteHash(t *testing.T) {
+	ms := &storage.MemStorage{}
+	hashKey := "secret"
+	r := remoteWriteRouter(ms, hashKey)
+	body := remoteWriteBody("HeapAlloc", 5)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	req.Header.Set("HashSHA256", "incorrect_hash")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	req.Header.Set("HashSHA256", base64.StdEncoding.EncodeToString(helpers.CalculateHash(body, hashKey)))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 5.0, ms.Snapshot().Gauge["HeapAlloc"])
+}
+
+func Test_remoteWriteLabels(t *testing.T) {
+	ms := &storage.MemStorage{}
+	r := remoteWriteRouter(ms, "")
+	body := prometheus.EncodeWriteRequest([]prometheus.TimeSeries{{
+		Labels:  []prometheus.Label{{Name: prometheus.NameLabel, Value: "load"}, {Name: "host", Value: "web1"}},
+		Samples: []prometheus.Sample{{Value: 1.5}},
+	}, {
+		Labels:  []prometheus.Label{{Name: prometheus.NameLabel, Value: "requests_total"}, {Name: "host", Value: "web1"}},
+		Samples: []prometheus.Sample{{Value: 4}},
+	}})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 1.5, ms.Snapshot().Gauge[`load{host="web1"}`])
+	assert.Equal(t, int64(4), ms.Snapshot().Counter[`requests{host="web1"}`])
+}
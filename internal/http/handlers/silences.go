@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"path"
+	"time"
+)
+
+// addSilence creates a silence from the body
+func addSilence(c *gin.Context, m storage.MStorage, syncWrite bool, filePath string) {
+	var silence storage.Silence
+	if err := json.NewDecoder(c.Request.Body).Decode(&silence); err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if silence.Matcher == "" {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if _, err := path.Match(silence.Matcher, ""); err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = time.Now()
+	}
+	if !silence.EndsAt.After(silence.StartsAt) {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	silence.ID = uuid.New().String()
+
+	if err := m.AddSilence(c, silence); err != nil {
+		log.Logger.Info("Error saving silence:", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if syncWrite {
+		helpers.WriteFile(m, filePath)
+	}
+	c.JSON(http.StatusCreated, silence)
+}
+
+// getSilences displays all silences
+func getSilences(c *gin.Context, m storage.MStorage) {
+	silences, err := m.GetSilences(c)
+	if err != nil {
+		log.Logger.Info("Error reading silences:", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, silences)
+}
+
+// deleteSilence removes the silence by the id that came in the url
+func deleteSilence(c *gin.Context, m storage.MStorage, syncWrite bool, filePath string) {
+	deleted, err := m.DeleteSilence(c, c.Param("id"))
+	if err != nil {
+		log.Logger.Info("Error deleting silence:", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if syncWrite {
+		helpers.WriteFile(m, filePath)
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func silencesRouter(ms *storage.MemStorage) *gin.Engine {
+	r := gin.New()
+	r.POST("/silences", func(c *gin.Context) {
+		addSilence(c, ms, false, "")
+	})
+	r.GET("/silences", func(c *gin.Context) {
+		getSilences(c, ms)
+	})
+	r.DELETE("/silences/:id", func(c *gin.Context) {
+		deleteSilence(c, ms, false, "")
+	})
+	return r
+}
+
+func Test_addSilence(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{
+			name: "valid",
+			body: `{"matcher":"PollCount","ends_at":"` + now.Add(time.Hour).Format(time.RFC3339) + `"}`,
+			want: http.StatusCreated,
+		},
+		{
+			name: "empty matcher",
+			body: `{"ends_at":"` + now.Add(time.Hour).Format(time.RFC3339) + `"}`,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "bad pattern",
+			body: `{"matcher":"[","ends_at":"` + now.Add(time.Hour).Format(time.RFC3339) + `"}`,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "ends before start",
+			body: `{"matcher":"PollCount","ends_at":"` + now.Add(-time.Hour).Format(time.RFC3339) + `"}`,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "invalid JSON",
+			body: `invalid_json`,
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := &storage.MemStorage{}
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/silences", bytes.NewBufferString(tt.body))
+			silencesRouter(ms).ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func Test_silencesLifecycle(t *testing.T) {
+	ms := &storage.MemStorage{}
+	r := silencesRouter(ms)
+	body := `{"matcher":"Heap*","ends_at":"` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/silences", bytes.NewBufferString(body))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created storage.Silence
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "/silences", nil)
+	r.ServeHTTP(w, req)
+	var silences []storage.Silence
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &silences))
+	assert.Len(t, silences, 1)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodDelete, "/silences/"+created.ID, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodDelete, "/silences/"+created.ID, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// streamPingInterval is the interval of the comments that keep an idle stream open through proxies
+const streamPingInterval = 15 * time.Second
+
+// streamFilter returns the filter of the name, type and match query params, nil when the request has none
+func streamFilter(c *gin.Context) (func(storage.Metrics) bool, error) {
+	matchers, err := parseMatchers(c)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	names := make(map[string]bool)
+	for _, name := range c.QueryArray("name") {
+		names[name] = true
+	}
+	types := make(map[string]bool)
+	for _, mtype := range c.QueryArray("type") {
+		switch mtype {
+		case config.Gauge, config.Counter, config.Histogram:
+			types[mtype] = true
+		default:
+			return nil, fmt.Errorf("%w: unknowning metric type %q", errBadRequest, mtype)
+		}
+	}
+	if len(matchers) == 0 && len(names) == 0 && len(types) == 0 {
+		return nil, nil
+	}
+	return func(metric storage.Metrics) bool {
+		if len(names) > 0 && !names[metric.ID] {
+			return false
+		}
+		if len(types) > 0 && !types[metric.MType] {
+			return false
+		}
+		return storage.MatchSeries(matchers, metric.ID, metric.Labels)
+	}, nil
+}
+
+// streamMetrics sends the updated series as server-sent events until the client disconnects.
+// Every event is named by the metric type and holds the series as JSON like /value/.
+// A client that can not keep up gets only the latest value of a series, one that falls behind
+// by storage.StreamMaxPending series gets the overflow event and the stream ends.
+func streamMetrics(c *gin.Context, stream *storage.Stream) {
+	filter, err := streamFilter(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	sub := stream.Subscribe(filter)
+	defer stream.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-sub.Done():
+			if sub.Overflowed() {
+				fmt.Fprint(c.Writer, "event: overflow\ndata: {}\n\n")
+				c.Writer.Flush()
+			}
+			return
+		case <-ping.C:
+			if _, err = fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-sub.Ready():
+			for _, metric := range sub.Next() {
+				data, err := json.Marshal(metric)
+				if err != nil {
+					log.Logger.Info("Error convert to JSON:", zap.Error(err))
+					continue
+				}
+				if _, err = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", metric.MType, data); err != nil {
+					return
+				}
+			}
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the lines of the next server-sent event
+func readEvent(t *testing.T, scanner *bufio.Scanner) []string {
+	var lines []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+	t.Fatalf("Stream ended: %v", scanner.Err())
+	return nil
+}
+
+func Test_streamMetrics(t *testing.T) {
+	stream := storage.NewStream()
+	ms := storage.NewPublisher(&storage.MemStorage{}, stream)
+	r := gin.New()
+	r.GET("/stream", func(c *gin.Context) {
+		streamMetrics(c, stream)
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream?type=bad")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stream?type=counter&name=PollCount", nil)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	for !stream.Active() {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, ms.GaugeStorage(ctx, "PollCount", 1))
+	assert.NoError(t, ms.CountStorage(ctx, "Requests", 1))
+	assert.NoError(t, ms.CountStorage(ctx, "PollCount", 2))
+	assert.NoError(t, ms.CountStorage(ctx, "PollCount", 3))
+
+	// обновления счетчика могут прийти по одному или уже объединенными
+	scanner := bufio.NewScanner(resp.Body)
+	for {
+		event := readEvent(t, scanner)
+		if !assert.Len(t, event, 2) {
+			break
+		}
+		assert.Equal(t, "event: counter", event[0])
+		assert.Contains(t, event[1], `"id":"PollCount"`)
+		if event[1] == `data: {"id":"PollCount","type":"counter","delta":5}` {
+			break
+		}
+	}
+
+	stream.Close()
+	for scanner.Scan() {
+		assert.False(t, strings.HasPrefix(scanner.Text(), "data:"), "Expected no more events")
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"crypto/rsa"
 	"github.com/Nchezhegova/metrics-alerts/internal/helpers"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"io"
 	"net/http"
 )
 
+// DecryptBody decrypts the request body encrypted by the agent with the public key,
+// both the envelope and the old format of helpers.DecryptData are accepted
 func DecryptBody(key *rsa.PrivateKey) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if key == nil {
@@ -23,11 +27,13 @@ func DecryptBody(key *rsa.PrivateKey) gin.HandlerFunc {
 		}
 		decryptedBody, err := helpers.DecryptData(encryptedBody, key)
 		if err != nil {
+			log.Logger.Info("Error decrypting body:", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "error decrypting body"})
 			c.Abort()
 			return
 		}
 		c.Request.Body = io.NopCloser(bytes.NewReader(decryptedBody))
+		c.Request.ContentLength = int64(len(decryptedBody))
 		c.Next()
 	}
 }
@@ -119,3 +119,59 @@ func TestDecryptBodyErrorDecryptData(t *testing.T) {
 		t.Errorf("expected status %d; got %d", http.StatusInternalServerError, w.Code)
 	}
 }
+
+func TestDecryptBodyFormats(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating RSA key pair: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(middleware.DecryptBody(key))
+	{
+		r.POST("/test", func(c *gin.Context) {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil || c.Request.ContentLength != int64(len(body)) {
+				c.String(http.StatusInternalServerError, "error reading body")
+				return
+			}
+			c.String(http.StatusOK, string(body))
+		})
+	}
+
+	large := bytes.Repeat([]byte("Hello, world!"), 1000)
+	envelope, err := helpers.EncryptData(large, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("error encrypting body: %v", err)
+	}
+	legacy, err := rsa.EncryptPKCS1v15(rand.Reader, &key.PublicKey, []byte("Hello, world!"))
+	if err != nil {
+		t.Fatalf("error encrypting body: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		body []byte
+		want []byte
+	}{
+		{name: "Envelope larger than the key", body: envelope, want: large},
+		{name: "Old format", body: legacy, want: []byte("Hello, world!")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/test", bytes.NewBuffer(tt.body))
+			if err != nil {
+				t.Fatalf("error creating request: %v", err)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status %d; got %d", http.StatusOK, w.Code)
+			}
+			if w.Body.String() != string(tt.want) {
+				t.Errorf("expected body of %d bytes; got %d", len(tt.want), w.Body.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package prometheus
+
+import (
+	"bufio"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// CounterSuffix is appended to counter names as the Prometheus naming convention requires
+const CounterSuffix = "_total"
+
+// SanitizeName replaces characters that are not allowed in Prometheus metric names
+func SanitizeName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// CounterName returns the exposed name of the counter
+func CounterName(name string) string {
+	name = SanitizeName(name)
+	if strings.HasSuffix(name, CounterSuffix) {
+		return name
+	}
+	return name + CounterSuffix
+}
+
+// formatValue formats the value as Prometheus expects
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// typeOrder decides which type wins a name collision
+var typeOrder = map[string]int{"gauge": 0, "counter": 1, "histogram": 2}
+
+// series is one exposed series
+type series struct {
+	name      string
+	original  string
+	labels    map[string]string
+	key       string
+	mtype     string
+	value     string
+	histogram storage.Histogram
+}
+
+// newSeries parses the storage key of the series
+func newSeries(key string, mtype string, value string) series {
+	id, labels := storage.ParseMetricKey(key)
+	name := SanitizeName(id)
+	if mtype == "counter" {
+		name = CounterName(id)
+	}
+	return series{name: name, original: id, labels: labels, key: storage.MetricKey("", labels), mtype: mtype, value: value}
+}
+
+// write writes the sample lines of the series, labels are formatted as {name="value",...}
+func (s series) write(bw *bufio.Writer) {
+	if s.mtype != "histogram" {
+		bw.WriteString(s.name + s.key + " " + s.value + "\n")
+		return
+	}
+	labels := make(map[string]string, len(s.labels)+1)
+	for name, value := range s.labels {
+		labels[name] = value
+	}
+	var cumulative uint64
+	for i, bound := range s.histogram.Buckets {
+		cumulative += s.histogram.Counts[i]
+		labels["le"] = formatValue(bound)
+		bw.WriteString(s.name + "_bucket" + storage.MetricKey("", labels) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+	}
+	labels["le"] = "+Inf"
+	bw.WriteString(s.name + "_bucket" + storage.MetricKey("", labels) + " " + strconv.FormatUint(s.histogram.Count, 10) + "\n")
+	bw.WriteString(s.name + "_sum" + s.key + " " + formatValue(s.histogram.Sum) + "\n")
+	bw.WriteString(s.name + "_count" + s.key + " " + strconv.FormatUint(s.histogram.Count, 10) + "\n")
+}
+
+// WriteText writes gauges, counters and histograms in the text exposition format sorted by name,
+// the keys are storage series keys and their labels are exposed as Prometheus labels.
+// When sanitised names collide, a gauge whose name needed no changes wins and the rest are skipped.
+func WriteText(w io.Writer, gauges map[string]float64, counters map[string]int64, histograms map[string]storage.Histogram) error {
+	all := make([]series, 0, len(gauges)+len(counters)+len(histograms))
+	for key, v := range gauges {
+		all = append(all, newSeries(key, "gauge", formatValue(v)))
+	}
+	for key, v := range counters {
+		all = append(all, newSeries(key, "counter", strconv.FormatInt(v, 10)))
+	}
+	for key, h := range histograms {
+		s := newSeries(key, "histogram", "")
+		s.histogram = h
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].name != all[j].name {
+			return all[i].name < all[j].name
+		}
+		if all[i].mtype != all[j].mtype {
+			return typeOrder[all[i].mtype] < typeOrder[all[j].mtype]
+		}
+		if exactI, exactJ := all[i].original == all[i].name, all[j].original == all[j].name; exactI != exactJ {
+			return exactI
+		}
+		if all[i].original != all[j].original {
+			return all[i].original < all[j].original
+		}
+		return all[i].key < all[j].key
+	})
+
+	bw := bufio.NewWriter(w)
+	owners := make(map[string]string, len(all))
+	for _, s := range all {
+		owner := s.mtype + " " + s.original
+		if written, exists := owners[s.name]; exists && written != owner {
+			continue
+		} else if !exists {
+			owners[s.name] = owner
+			bw.WriteString("# TYPE " + s.name + " " + s.mtype + "\n")
+		}
+		s.write(bw)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,96 @@
+package prometheus
+
+import (
+	"bytes"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "HeapAlloc", want: "HeapAlloc"},
+		{name: "host-1.cpu", want: "host_1_cpu"},
+		{name: "1min", want: "_1min"},
+		{name: "a:b", want: "a:b"},
+		{name: "", want: "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SanitizeName(tt.name))
+		})
+	}
+}
+
+func TestCounterName(t *testing.T) {
+	assert.Equal(t, "PollCount_total", CounterName("PollCount"))
+	assert.Equal(t, "requests_total", CounterName("requests_total"))
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteText(&buf, map[string]float64{
+		"HeapAlloc":   1.5e6,
+		"host-1.load": 0.25,
+		"host_1_load": 0.5,
+		"Inf":         math.Inf(1),
+	}, map[string]int64{
+		"PollCount": 5,
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE HeapAlloc gauge\n"+
+		"HeapAlloc 1.5e+06\n"+
+		"# TYPE Inf gauge\n"+
+		"Inf +Inf\n"+
+		"# TYPE PollCount_total counter\n"+
+		"PollCount_total 5\n"+
+		"# TYPE host_1_load gauge\n"+
+		"host_1_load 0.5\n", buf.String())
+}
+
+func TestWriteTextLabels(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteText(&buf, map[string]float64{
+		`load{host="web2"}`:            2,
+		`load{env="prod",host="web1"}`: 1,
+		`note{text="a \"b\"\nc"}`:      3,
+	}, map[string]int64{
+		`requests{host="web1"}`: 7,
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE load gauge\n"+
+		`load{env="prod",host="web1"} 1`+"\n"+
+		`load{host="web2"} 2`+"\n"+
+		"# TYPE note gauge\n"+
+		`note{text="a \"b\"\nc"} 3`+"\n"+
+		"# TYPE requests_total counter\n"+
+		`requests_total{host="web1"} 7`+"\n", buf.String())
+}
+
+func TestWriteTextHistogram(t *testing.T) {
+	h := storage.NewHistogram([]float64{0.1, 1})
+	for _, v := range []float64{0.05, 0.5, 0.7, 3} {
+		h.Observe(v)
+	}
+	var buf bytes.Buffer
+	err := WriteText(&buf, map[string]float64{"latency": 1}, nil, map[string]storage.Histogram{
+		`latency{host="web1"}`: h,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE latency gauge\n"+
+		"latency 1\n", buf.String(), "Expected the gauge to win the name collision")
+
+	buf.Reset()
+	err = WriteText(&buf, nil, nil, map[string]storage.Histogram{`latency{host="web1"}`: h})
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE latency histogram\n"+
+		`latency_bucket{host="web1",le="0.1"} 1`+"\n"+
+		`latency_bucket{host="web1",le="1"} 3`+"\n"+
+		`latency_bucket{host="web1",le="+Inf"} 4`+"\n"+
+		`latency_sum{host="web1"} 4.25`+"\n"+
+		`latency_count{host="web1"} 4`+"\n", buf.String())
+}
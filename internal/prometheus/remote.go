@@ -0,0 +1,218 @@
+package prometheus
+
+import (
+	"fmt"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+)
+
+// NameLabel is the label holding the metric name
+const NameLabel = "__name__"
+
+// Label is a remote_write label pair
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a remote_write sample, Timestamp is in milliseconds
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries is a remote_write series with its samples
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Name returns the value of the __name__ label
+func (ts TimeSeries) Name() string {
+	for _, l := range ts.Labels {
+		if l.Name == NameLabel {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// LabelMap returns the labels of the series except __name__
+func (ts TimeSeries) LabelMap() map[string]string {
+	labels := make(map[string]string, len(ts.Labels))
+	for _, l := range ts.Labels {
+		if l.Name != NameLabel {
+			labels[l.Name] = l.Value
+		}
+	}
+	return labels
+}
+
+// Latest returns the sample with the greatest timestamp
+func (ts TimeSeries) Latest() (Sample, bool) {
+	if len(ts.Samples) == 0 {
+		return Sample{}, false
+	}
+	latest := ts.Samples[0]
+	for _, s := range ts.Samples[1:] {
+		if s.Timestamp >= latest.Timestamp {
+			latest = s
+		}
+	}
+	return latest, true
+}
+
+// DecodeWriteRequest decodes a snappy-compressed protobuf WriteRequest
+func DecodeWriteRequest(compressed []byte) ([]TimeSeries, error) {
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, err
+	}
+	var res []TimeSeries
+	err = eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := decodeTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		res = append(res, ts)
+		return nil
+	})
+	return res, err
+}
+
+func decodeTimeSeries(data []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			l, err := decodeLabel(v)
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case 2:
+			s, err := decodeSample(v)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func decodeLabel(data []byte) (Label, error) {
+	var l Label
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			l.Name = string(v)
+		case 2:
+			l.Value = string(v)
+		}
+		return nil
+	})
+	return l, err
+}
+
+func decodeSample(data []byte) (Sample, error) {
+	var s Sample
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return s, protowire.ParseError(n)
+		}
+		data = data[n:]
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.Value = math.Float64frombits(v)
+			data = data[n:]
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.Timestamp = int64(v)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return s, nil
+}
+
+// eachField calls fn for every field of the message, bytes fields are passed as their content
+func eachField(data []byte, fn func(protowire.Number, protowire.Type, []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, typ, v); err != nil {
+				return err
+			}
+			data = data[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// EncodeWriteRequest encodes series as a snappy-compressed protobuf WriteRequest
+func EncodeWriteRequest(series []TimeSeries) []byte {
+	var req []byte
+	for _, ts := range series {
+		var tsb []byte
+		for _, l := range ts.Labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Value)
+			tsb = protowire.AppendTag(tsb, 1, protowire.BytesType)
+			tsb = protowire.AppendBytes(tsb, lb)
+		}
+		for _, s := range ts.Samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(s.Value))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+			tsb = protowire.AppendTag(tsb, 2, protowire.BytesType)
+			tsb = protowire.AppendBytes(tsb, sb)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, tsb)
+	}
+	return snappy.Encode(nil, req)
+}
@@ -0,0 +1,32 @@
+package prometheus
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWriteRequestRoundTrip(t *testing.T) {
+	series := []TimeSeries{
+		{
+			Labels:  []Label{{Name: NameLabel, Value: "HeapAlloc"}, {Name: "job", Value: "agent"}},
+			Samples: []Sample{{Value: 1.5, Timestamp: 1000}, {Value: 2.5, Timestamp: 2000}},
+		},
+		{
+			Labels:  []Label{{Name: NameLabel, Value: "PollCount_total"}},
+			Samples: []Sample{{Value: 10, Timestamp: 1000}},
+		},
+	}
+	decoded, err := DecodeWriteRequest(EncodeWriteRequest(series))
+	assert.NoError(t, err)
+	assert.Equal(t, series, decoded)
+	assert.Equal(t, "HeapAlloc", decoded[0].Name())
+
+	latest, ok := decoded[0].Latest()
+	assert.True(t, ok)
+	assert.Equal(t, 2.5, latest.Value)
+}
+
+func TestDecodeWriteRequestInvalid(t *testing.T) {
+	_, err := DecodeWriteRequest([]byte("not snappy"))
+	assert.Error(t, err)
+}
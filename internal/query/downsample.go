@@ -0,0 +1,134 @@
+package query
+
+import (
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"math"
+	"sort"
+	"time"
+)
+
+// Aggregation functions applied to samples of one step
+const (
+	FnMin  = "min"
+	FnMax  = "max"
+	FnAvg  = "avg"
+	FnSum  = "sum"
+	FnLast = "last"
+	FnRate = "rate"
+	FnP95  = "p95"
+)
+
+// aggregators maps the function name to its implementation
+var aggregators = map[string]func([]storage.Sample) (float64, bool){
+	FnMin:  aggMin,
+	FnMax:  aggMax,
+	FnAvg:  aggAvg,
+	FnSum:  aggSum,
+	FnLast: aggLast,
+	FnRate: Rate,
+	FnP95:  aggP95,
+}
+
+// Downsample splits samples into steps starting at from and aggregates each step with the function.
+// Steps without samples are skipped.
+func Downsample(samples []storage.Sample, from time.Time, to time.Time, step time.Duration, fn string) ([]storage.Sample, error) {
+	agg, ok := aggregators[fn]
+	if !ok {
+		return nil, fmt.Errorf("unknowning aggregation function %q", fn)
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("to is before from")
+	}
+
+	points := []storage.Sample{}
+	i := 0
+	for start := from; !start.After(to); start = start.Add(step) {
+		end := start.Add(step)
+		var bucket []storage.Sample
+		for ; i < len(samples) && samples[i].Time.Before(end); i++ {
+			if samples[i].Time.Before(start) || samples[i].Time.After(to) {
+				continue
+			}
+			bucket = append(bucket, samples[i])
+		}
+		if len(bucket) == 0 {
+			continue
+		}
+		if v, ok := agg(bucket); ok {
+			points = append(points, storage.Sample{Time: start, Value: v})
+		}
+	}
+	return points, nil
+}
+
+func aggMin(samples []storage.Sample) (float64, bool) {
+	res := math.Inf(1)
+	for _, s := range samples {
+		res = math.Min(res, s.Value)
+	}
+	return res, true
+}
+
+func aggMax(samples []storage.Sample) (float64, bool) {
+	res := math.Inf(-1)
+	for _, s := range samples {
+		res = math.Max(res, s.Value)
+	}
+	return res, true
+}
+
+func aggSum(samples []storage.Sample) (float64, bool) {
+	var res float64
+	for _, s := range samples {
+		res += s.Value
+	}
+	return res, true
+}
+
+func aggAvg(samples []storage.Sample) (float64, bool) {
+	sum, _ := aggSum(samples)
+	return sum / float64(len(samples)), true
+}
+
+func aggLast(samples []storage.Sample) (float64, bool) {
+	return samples[len(samples)-1].Value, true
+}
+
+// Rate returns the per-second increase between the first and the last sample, counting drops as resets.
+// It is false when there are less than two samples or they have the same time.
+func Rate(samples []storage.Sample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	seconds := samples[len(samples)-1].Time.Sub(samples[0].Time).Seconds()
+	if seconds <= 0 {
+		return 0, false
+	}
+	var increase float64
+	for i := 1; i < len(samples); i++ {
+		if d := samples[i].Value - samples[i-1].Value; d >= 0 {
+			increase += d
+		} else {
+			increase += samples[i].Value
+		}
+	}
+	return increase / seconds, true
+}
+
+// aggP95 returns the 95th percentile by the nearest-rank method
+func aggP95(samples []storage.Sample) (float64, bool) {
+	values := make([]float64, len(samples))
+	for i, s := range samples {
+		values[i] = s.Value
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(0.95*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank], true
+}
@@ -0,0 +1,76 @@
+package query
+
+import (
+	"github.com/Nchezhegova/metrics-alerts/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testSamples(start time.Time, values ...float64) []storage.Sample {
+	res := make([]storage.Sample, len(values))
+	for i, v := range values {
+		res[i] = storage.Sample{Time: start.Add(time.Duration(i*10) * time.Second), Value: v}
+	}
+	return res
+}
+
+func TestDownsample(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// шаг 30s: [1 2 3] [4 5 6] [10]
+	samples := testSamples(start, 1, 2, 3, 4, 5, 6, 10)
+	to := start.Add(time.Minute)
+	tests := []struct {
+		fn   string
+		want []float64
+	}{
+		{fn: FnMin, want: []float64{1, 4, 10}},
+		{fn: FnMax, want: []float64{3, 6, 10}},
+		{fn: FnAvg, want: []float64{2, 5, 10}},
+		{fn: FnSum, want: []float64{6, 15, 10}},
+		{fn: FnLast, want: []float64{3, 6, 10}},
+		{fn: FnRate, want: []float64{0.1, 0.1}},
+		{fn: FnP95, want: []float64{3, 6, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fn, func(t *testing.T) {
+			points, err := Downsample(samples, start, to, 30*time.Second, tt.fn)
+			assert.NoError(t, err)
+			var values []float64
+			for _, p := range points {
+				values = append(values, p.Value)
+			}
+			assert.InDeltaSlice(t, tt.want, values, 1e-9)
+		})
+	}
+}
+
+func TestDownsample_SkipsEmptySteps(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := []storage.Sample{
+		{Time: start, Value: 1},
+		{Time: start.Add(5 * time.Minute), Value: 2},
+	}
+	points, err := Downsample(samples, start, start.Add(10*time.Minute), time.Minute, FnLast)
+	assert.NoError(t, err)
+	assert.Len(t, points, 2)
+	assert.Equal(t, start.Add(5*time.Minute), points[1].Time)
+}
+
+func TestDownsample_RateWithReset(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := testSamples(start, 10, 20, 5)
+	points, err := Downsample(samples, start, start.Add(time.Minute), time.Minute, FnRate)
+	assert.NoError(t, err)
+	assert.InDelta(t, 15.0/20, points[0].Value, 1e-9)
+}
+
+func TestDownsample_Errors(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := Downsample(nil, start, start.Add(time.Minute), time.Second, "median")
+	assert.Error(t, err)
+	_, err = Downsample(nil, start, start.Add(time.Minute), 0, FnAvg)
+	assert.Error(t, err)
+	_, err = Downsample(nil, start, start.Add(-time.Minute), time.Second, FnAvg)
+	assert.Error(t, err)
+}
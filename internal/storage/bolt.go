@@ -0,0 +1,624 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Buckets of the bolt file, samples has a nested bucket per series,
+// reported has a nested bucket per counter with the last values of the sources
+var (
+	gaugeBucket     = []byte("gauge")
+	counterBucket   = []byte("counter")
+	histogramBucket = []byte("histogram")
+	silenceBucket   = []byte("silences")
+	samplesBucket   = []byte("samples")
+	updatedBucket   = []byte("updated")
+	reportedBucket  = []byte("reported")
+)
+
+// BoltStorage keeps metrics in a local bbolt file.
+// Every update is written in its own transaction, so only the changed series are rewritten.
+type BoltStorage struct {
+	HistorySize      int           `json:"-"`
+	HistoryRetention time.Duration `json:"-"`
+
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates the bolt file
+func OpenBolt(path string, historySize int, historyRetention time.Duration) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{gaugeBucket, counterBucket, histogramBucket, silenceBucket, samplesBucket, updatedBucket, reportedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStorage{
+		HistorySize:      historySize,
+		HistoryRetention: historyRetention,
+		db:               db,
+	}, nil
+}
+
+// Close closes the bolt file
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
+
+// Ping checks that the bolt file is open
+func (b *BoltStorage) Ping(c context.Context) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+func encodeFloat(v float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(v))
+}
+
+func decodeFloat(data []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(data))
+}
+
+func encodeInt(v int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(v))
+}
+
+func decodeInt(data []byte) int64 {
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+func (b *BoltStorage) CountStorage(c context.Context, k string, v int64) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		_, err := b.count(tx, k, v)
+		return err
+	})
+}
+
+// count adds the delta to the counter in the transaction and returns the total
+func (b *BoltStorage) count(tx *bolt.Tx, k string, v int64) (int64, error) {
+	bucket := tx.Bucket(counterBucket)
+	total := v
+	if data := bucket.Get([]byte(k)); data != nil {
+		total += decodeInt(data)
+	}
+	if err := bucket.Put([]byte(k), encodeInt(total)); err != nil {
+		return 0, err
+	}
+	if err := touch(tx, config.Counter, k, time.Now()); err != nil {
+		return 0, err
+	}
+	return total, b.record(tx, config.Counter, k, float64(total))
+}
+
+func (b *BoltStorage) GaugeStorage(c context.Context, k string, v float64) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return b.gauge(tx, k, v)
+	})
+}
+
+// gauge sets the gauge in the transaction
+func (b *BoltStorage) gauge(tx *bolt.Tx, k string, v float64) error {
+	if err := tx.Bucket(gaugeBucket).Put([]byte(k), encodeFloat(v)); err != nil {
+		return err
+	}
+	if err := touch(tx, config.Gauge, k, time.Now()); err != nil {
+		return err
+	}
+	return b.record(tx, config.Gauge, k, v)
+}
+
+// HistogramStorage merges the observations into the stored histogram
+func (b *BoltStorage) HistogramStorage(c context.Context, k string, h Histogram) error {
+	if err := h.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		_, err := mergeHistogram(tx, k, h)
+		return err
+	})
+}
+
+// mergeHistogram merges the observations in the transaction and returns the new total
+func mergeHistogram(tx *bolt.Tx, k string, h Histogram) (Histogram, error) {
+	bucket := tx.Bucket(histogramBucket)
+	var old Histogram
+	if data := bucket.Get([]byte(k)); data != nil {
+		if err := json.Unmarshal(data, &old); err != nil {
+			return Histogram{}, err
+		}
+	}
+	merged := old.Merge(h)
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return Histogram{}, err
+	}
+	if err = touch(tx, config.Histogram, k, time.Now()); err != nil {
+		return Histogram{}, err
+	}
+	return merged, bucket.Put([]byte(k), data)
+}
+
+// touch sets the time of the last update of the series in the transaction
+func touch(tx *bolt.Tx, mtype string, k string, t time.Time) error {
+	return tx.Bucket(updatedBucket).Put([]byte(seriesKey(mtype, k)), encodeInt(t.UnixNano()))
+}
+
+// record adds the value to the samples of the series and drops the samples over the size and retention.
+// Like in MemStorage, a size that is not positive keeps DefaultHistorySize samples.
+func (b *BoltStorage) record(tx *bolt.Tx, mtype string, name string, v float64) error {
+	bucket, err := tx.Bucket(samplesBucket).CreateBucketIfNotExists([]byte(seriesKey(mtype, name)))
+	if err != nil {
+		return err
+	}
+	// число записей серии хранится в Sequence бакета, у бакетов старых версий оно считается один раз
+	count := bucket.Sequence()
+	if count == 0 {
+		cursor := bucket.Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			count++
+		}
+	}
+	now := time.Now()
+	key := encodeInt(now.UnixNano())
+	if bucket.Get(key) == nil {
+		count++
+	}
+	if err = bucket.Put(key, encodeFloat(v)); err != nil {
+		return err
+	}
+
+	size := uint64(b.HistorySize)
+	if b.HistorySize <= 0 {
+		size = DefaultHistorySize
+	}
+	// самые старые записи идут первыми, обход останавливается на первой, которую нужно оставить
+	var stale [][]byte
+	cursor := bucket.Cursor()
+	for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+		expired := b.HistoryRetention > 0 && now.Sub(time.Unix(0, decodeInt(k))) > b.HistoryRetention
+		if count-uint64(len(stale)) <= size && !expired {
+			break
+		}
+		stale = append(stale, append([]byte(nil), k...))
+	}
+	// ключи удаляются после обхода, удаление под курсором сдвигает его
+	for _, k := range stale {
+		if err = bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return bucket.SetSequence(count - uint64(len(stale)))
+}
+
+func (b *BoltStorage) GetRange(c context.Context, mtype string, name string, from time.Time, to time.Time) ([]Sample, error) {
+	if b.HistoryRetention > 0 {
+		if oldest := time.Now().Add(-b.HistoryRetention); from.Before(oldest) {
+			from = oldest
+		}
+	}
+	res := []Sample{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(samplesBucket).Bucket([]byte(seriesKey(mtype, name)))
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		end := to.UnixNano()
+		for k, v := cursor.Seek(encodeInt(from.UnixNano())); k != nil && decodeInt(k) <= end; k, v = cursor.Next() {
+			res = append(res, Sample{Time: time.Unix(0, decodeInt(k)), Value: decodeFloat(v)})
+		}
+		return nil
+	})
+	return res, err
+}
+
+// GetStorage returns all metrics and silences as Snapshot
+func (b *BoltStorage) GetStorage(c context.Context) (Snapshot, error) {
+	return b.Snapshot(c)
+}
+
+// Snapshot reads all metrics and silences of the bolt file
+func (b *BoltStorage) Snapshot(c context.Context) (Snapshot, error) {
+	res := Snapshot{
+		Gauge:      make(map[string]float64),
+		Counter:    make(map[string]int64),
+		Histograms: make(map[string]Histogram),
+		Silences:   make(map[string]Silence),
+	}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(gaugeBucket).ForEach(func(k, v []byte) error {
+			res.Gauge[string(k)] = decodeFloat(v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(counterBucket).ForEach(func(k, v []byte) error {
+			res.Counter[string(k)] = decodeInt(v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(histogramBucket).ForEach(func(k, v []byte) error {
+			var h Histogram
+			if err := json.Unmarshal(v, &h); err != nil {
+				return err
+			}
+			res.Histograms[string(k)] = h
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(reportedBucket).ForEachBucket(func(k []byte) error {
+			return tx.Bucket(reportedBucket).Bucket(k).ForEach(func(source, v []byte) error {
+				if res.Reported == nil {
+					res.Reported = make(map[string]map[string]int64)
+				}
+				if res.Reported[string(k)] == nil {
+					res.Reported[string(k)] = make(map[string]int64)
+				}
+				res.Reported[string(k)][string(source)] = decodeInt(v)
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(silenceBucket).ForEach(func(k, v []byte) error {
+			var silence Silence
+			if err := json.Unmarshal(v, &silence); err != nil {
+				return err
+			}
+			res.Silences[string(k)] = silence
+			return nil
+		})
+	})
+	return res, err
+}
+
+// SetStartData writes the restored metrics into the bolt file, existing series are overwritten
+func (b *BoltStorage) SetStartData(storage Snapshot) {
+	now := time.Now()
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for k, v := range storage.Gauge {
+			if err := tx.Bucket(gaugeBucket).Put([]byte(k), encodeFloat(v)); err != nil {
+				return err
+			}
+			if err := touch(tx, config.Gauge, k, now); err != nil {
+				return err
+			}
+		}
+		for k, v := range storage.Counter {
+			if err := tx.Bucket(counterBucket).Put([]byte(k), encodeInt(v)); err != nil {
+				return err
+			}
+			if err := touch(tx, config.Counter, k, now); err != nil {
+				return err
+			}
+		}
+		for k, h := range storage.Histograms {
+			data, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+			if err = tx.Bucket(histogramBucket).Put([]byte(k), data); err != nil {
+				return err
+			}
+			if err = touch(tx, config.Histogram, k, now); err != nil {
+				return err
+			}
+		}
+		for id, silence := range storage.Silences {
+			data, err := json.Marshal(silence)
+			if err != nil {
+				return err
+			}
+			if err = tx.Bucket(silenceBucket).Put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+		for k, sources := range storage.Reported {
+			for source, v := range sources {
+				if err := report(tx, k, source, v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Logger.Info("Error restoring bolt storage:", zap.Error(err))
+	}
+}
+
+func (b *BoltStorage) GetGauge(c context.Context, key string) (float64, error) {
+	var v float64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(gaugeBucket).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		v = decodeFloat(data)
+		return nil
+	})
+	return v, err
+}
+
+func (b *BoltStorage) GetCount(c context.Context, key string) (int64, error) {
+	var v int64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(counterBucket).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		v = decodeInt(data)
+		return nil
+	})
+	return v, err
+}
+
+func (b *BoltStorage) GetHistogram(c context.Context, key string) (Histogram, error) {
+	var h Histogram
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(histogramBucket).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &h)
+	})
+	return h, err
+}
+
+// UpdateBatch applies all metrics in one transaction or none of them.
+// Counters and histograms in the list are replaced with the totals after the update.
+func (b *BoltStorage) UpdateBatch(c context.Context, list []Metrics) error {
+	for _, metric := range list {
+		if err := metric.Validate(); err != nil {
+			return err
+		}
+	}
+	var counters map[string]int64
+	var histograms map[string]Histogram
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		counters, histograms, err = b.apply(tx, list)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	setTotals(list, counters, histograms)
+	return nil
+}
+
+// UpdateFromSource saves the list with the counters reported by the source as cumulative values.
+// The increase and the last values of the source are written in one transaction.
+func (b *BoltStorage) UpdateFromSource(c context.Context, source string, list []Metrics) error {
+	for _, metric := range list {
+		if err := metric.Validate(); err != nil {
+			return err
+		}
+	}
+	var counters map[string]int64
+	var histograms map[string]Histogram
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		deltas, reported := toDeltas(source, list, func(key string) int64 {
+			if bucket := tx.Bucket(reportedBucket).Bucket([]byte(key)); bucket != nil {
+				if data := bucket.Get([]byte(source)); data != nil {
+					return decodeInt(data)
+				}
+			}
+			return 0
+		})
+		var err error
+		if counters, histograms, err = b.apply(tx, deltas); err != nil {
+			return err
+		}
+		for k, v := range reported {
+			if err = report(tx, k, source, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	setTotals(list, counters, histograms)
+	return nil
+}
+
+// apply writes the metrics in the transaction and returns the totals of the counters and histograms
+func (b *BoltStorage) apply(tx *bolt.Tx, list []Metrics) (map[string]int64, map[string]Histogram, error) {
+	counters := make(map[string]int64)
+	histograms := make(map[string]Histogram)
+	for _, metric := range list {
+		var err error
+		switch metric.MType {
+		case config.Gauge:
+			err = b.gauge(tx, metric.Key(), *metric.Value)
+		case config.Counter:
+			counters[metric.Key()], err = b.count(tx, metric.Key(), *metric.Delta)
+		case config.Histogram:
+			histograms[metric.Key()], err = mergeHistogram(tx, metric.Key(), *metric.Histogram)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return counters, histograms, nil
+}
+
+// report saves the last cumulative value of the counter reported by the source
+func report(tx *bolt.Tx, k string, source string, v int64) error {
+	bucket, err := tx.Bucket(reportedBucket).CreateBucketIfNotExists([]byte(k))
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(source), encodeInt(v))
+}
+
+func (b *BoltStorage) AddSilence(c context.Context, silence Silence) error {
+	data, err := json.Marshal(silence)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(silenceBucket).Put([]byte(silence.ID), data)
+	})
+}
+
+func (b *BoltStorage) GetSilences(c context.Context) ([]Silence, error) {
+	res := []Silence{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(silenceBucket).ForEach(func(k, v []byte) error {
+			var silence Silence
+			if err := json.Unmarshal(v, &silence); err != nil {
+				return err
+			}
+			res = append(res, silence)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].StartsAt.Before(res[j].StartsAt)
+	})
+	return res, nil
+}
+
+func (b *BoltStorage) DeleteSilence(c context.Context, id string) (bool, error) {
+	var deleted bool
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(silenceBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return nil
+		}
+		deleted = true
+		return bucket.Delete([]byte(id))
+	})
+	return deleted, err
+}
+
+// valueBuckets maps the metric types to the buckets of their values
+var valueBuckets = map[string][]byte{
+	config.Gauge:     gaugeBucket,
+	config.Counter:   counterBucket,
+	config.Histogram: histogramBucket,
+}
+
+// remove deletes the series with its samples and reported values in the transaction and reports whether it existed
+func remove(tx *bolt.Tx, mtype string, k string) (bool, error) {
+	bucket := tx.Bucket(valueBuckets[mtype])
+	if bucket.Get([]byte(k)) == nil {
+		return false, nil
+	}
+	if err := bucket.Delete([]byte(k)); err != nil {
+		return false, err
+	}
+	if mtype == config.Counter && tx.Bucket(reportedBucket).Bucket([]byte(k)) != nil {
+		if err := tx.Bucket(reportedBucket).DeleteBucket([]byte(k)); err != nil {
+			return false, err
+		}
+	}
+	key := []byte(seriesKey(mtype, k))
+	if tx.Bucket(samplesBucket).Bucket(key) != nil {
+		if err := tx.Bucket(samplesBucket).DeleteBucket(key); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Bucket(updatedBucket).Delete(key)
+}
+
+// DeleteMetrics removes the series of the metrics in one transaction and returns how many of them existed
+func (b *BoltStorage) DeleteMetrics(c context.Context, list []Metrics) (int, error) {
+	for _, metric := range list {
+		if err := metric.ValidateSeries(); err != nil {
+			return 0, err
+		}
+	}
+	var deleted int
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		deleted = 0
+		for _, metric := range list {
+			ok, err := remove(tx, metric.MType, metric.Key())
+			if err != nil {
+				return err
+			}
+			if ok {
+				deleted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// Expire removes the series that were not updated since the time and returns their number.
+// Series written before the updated bucket existed have no time and are kept until their next update.
+func (b *BoltStorage) Expire(c context.Context, before time.Time) (int, error) {
+	var deleted int
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		deleted = 0
+		var stale []string
+		err := tx.Bucket(updatedBucket).ForEach(func(k, v []byte) error {
+			if decodeInt(v) < before.UnixNano() {
+				stale = append(stale, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// серии удаляются после обхода, изменение бакета во время ForEach запрещено
+		for _, key := range stale {
+			mtype, name, _ := strings.Cut(key, ":")
+			ok, err := remove(tx, mtype, name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// значения уже нет, остается только время обновления
+				if err = tx.Bucket(updatedBucket).Delete([]byte(key)); err != nil {
+					return err
+				}
+				continue
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
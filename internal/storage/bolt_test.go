@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestBolt(t *testing.T, historySize int) (*BoltStorage, string) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	b, err := OpenBolt(path, historySize, time.Hour)
+	assert.NoError(t, err)
+	return b, path
+}
+
+func TestBoltStorage(t *testing.T) {
+	b, path := openTestBolt(t, 10)
+	ctx := context.Background()
+	key := MetricKey("HeapAlloc", map[string]string{"host": "web1"})
+
+	assert.NoError(t, b.Ping(ctx))
+	assert.NoError(t, b.GaugeStorage(ctx, key, 1.5))
+	assert.NoError(t, b.CountStorage(ctx, "PollCount", 2))
+	assert.NoError(t, b.CountStorage(ctx, "PollCount", 3))
+	h := NewHistogram([]float64{1, 5})
+	h.Observe(0.5)
+	assert.NoError(t, b.HistogramStorage(ctx, "latency", h))
+	assert.ErrorIs(t, b.HistogramStorage(ctx, "latency", Histogram{Buckets: []float64{1}}), ErrInvalidMetric)
+	assert.NoError(t, b.Close())
+
+	b, err := OpenBolt(path, 10, time.Hour)
+	assert.NoError(t, err)
+	defer b.Close()
+	v, err := b.GetGauge(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, v)
+	d, err := b.GetCount(ctx, "PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), d)
+	res, err := b.GetHistogram(ctx, "latency")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), res.Count)
+	_, err = b.GetGauge(ctx, "HeapAlloc")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	gauges, counters, err := ListValues(ctx, b)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{key: 1.5}, gauges)
+	assert.Equal(t, map[string]int64{"PollCount": 5}, counters)
+}
+
+func TestBoltStorage_UpdateBatch(t *testing.T) {
+	b, _ := openTestBolt(t, 10)
+	defer b.Close()
+	ctx := context.Background()
+	var v = 1.5
+	var d int64 = 5
+	list := []Metrics{
+		{ID: "PollCount", MType: "counter", Delta: &d},
+		{ID: "HeapAlloc", MType: "gauge", Value: &v},
+		{ID: "PollCount", MType: "counter", Delta: &d},
+	}
+	assert.NoError(t, b.UpdateBatch(ctx, list))
+	assert.Equal(t, int64(10), *list[0].Delta)
+	assert.Equal(t, int64(10), *list[2].Delta)
+
+	err := b.UpdateBatch(ctx, []Metrics{
+		{ID: "PollCount", MType: "counter", Delta: &d},
+		{ID: "HeapAlloc", MType: "gauge"},
+	})
+	assert.ErrorIs(t, err, ErrInvalidMetric)
+	total, err := b.GetCount(ctx, "PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), total, "Expected an invalid batch not to be applied")
+}
+
+func TestBoltStorage_GetRange(t *testing.T) {
+	b, _ := openTestBolt(t, 2)
+	defer b.Close()
+	ctx := context.Background()
+	from := time.Now().Add(-time.Minute)
+	for _, v := range []float64{1, 2, 3} {
+		assert.NoError(t, b.GaugeStorage(ctx, "HeapAlloc", v))
+	}
+
+	samples, err := b.GetRange(ctx, "gauge", "HeapAlloc", from, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2, "Expected the oldest sample to be dropped")
+	assert.Equal(t, 2.0, samples[0].Value)
+	assert.Equal(t, 3.0, samples[1].Value)
+
+	samples, err = b.GetRange(ctx, "counter", "HeapAlloc", from, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestBoltStorage_HistorySize(t *testing.T) {
+	b, path := openTestBolt(t, 3)
+	ctx := context.Background()
+	from := time.Now().Add(-time.Minute)
+	for _, v := range []float64{1, 2, 3, 4} {
+		assert.NoError(t, b.GaugeStorage(ctx, "HeapAlloc", v))
+	}
+	// бакет без счетчика записей, как у файлов старых версий
+	assert.NoError(t, b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(samplesBucket).Bucket([]byte(seriesKey("gauge", "HeapAlloc"))).SetSequence(0)
+	}))
+	assert.NoError(t, b.Close())
+
+	b, err := OpenBolt(path, 2, time.Hour)
+	assert.NoError(t, err)
+	defer b.Close()
+	assert.NoError(t, b.GaugeStorage(ctx, "HeapAlloc", 5))
+	assert.NoError(t, b.GaugeStorage(ctx, "HeapAlloc", 6))
+	samples, err := b.GetRange(ctx, "gauge", "HeapAlloc", from, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	if assert.Len(t, samples, 2) {
+		assert.Equal(t, 5.0, samples[0].Value)
+		assert.Equal(t, 6.0, samples[1].Value)
+	}
+
+	b.HistorySize = 0
+	assert.NoError(t, b.GaugeStorage(ctx, "HeapAlloc", 7))
+	samples, err = b.GetRange(ctx, "gauge", "HeapAlloc", from, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, samples, 3, "Expected DefaultHistorySize samples to be kept")
+}
+
+func TestBoltStorage_Silences(t *testing.T) {
+	b, _ := openTestBolt(t, 10)
+	defer b.Close()
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	silence := Silence{ID: "1", Matcher: "Heap*", StartsAt: now, EndsAt: now.Add(time.Hour)}
+
+	assert.NoError(t, b.AddSilence(ctx, silence))
+	silences, err := b.GetSilences(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Silence{silence}, silences)
+
+	deleted, err := b.DeleteSilence(ctx, "1")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = b.DeleteSilence(ctx, "1")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestBoltStorage_SetStartData(t *testing.T) {
+	b, _ := openTestBolt(t, 10)
+	defer b.Close()
+	ctx := context.Background()
+	b.SetStartData(Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 36.6},
+		Counter: map[string]int64{"PollCount": 54},
+	})
+	v, err := b.GetGauge(ctx, "HeapAlloc")
+	assert.NoError(t, err)
+	assert.Equal(t, 36.6, v)
+	d, err := b.GetCount(ctx, "PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(54), d)
+}
+
+func TestBoltStorage_DeleteMetrics(t *testing.T) {
+	b, _ := openTestBolt(t, 10)
+	defer b.Close()
+	ctx := context.Background()
+	from := time.Now()
+	assert.NoError(t, b.GaugeStorage(ctx, "HeapAlloc", 1.5))
+	assert.NoError(t, b.CountStorage(ctx, "PollCount", 2))
+	assert.NoError(t, b.HistogramStorage(ctx, "latency", NewHistogram([]float64{1})))
+
+	deleted, err := b.DeleteMetrics(ctx, []Metrics{
+		{ID: "PollCount", MType: "counter"},
+		{ID: "latency", MType: "histogram"},
+		{ID: "HeapAlloc", MType: "counter"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	_, err = b.GetCount(ctx, "PollCount")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = b.GetHistogram(ctx, "latency")
+	assert.ErrorIs(t, err, ErrNotFound)
+	samples, err := b.GetRange(ctx, "counter", "PollCount", from, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, samples)
+	_, err = b.GetGauge(ctx, "HeapAlloc")
+	assert.NoError(t, err)
+
+	_, err = b.DeleteMetrics(ctx, []Metrics{{MType: "gauge"}})
+	assert.ErrorIs(t, err, ErrInvalidMetric)
+}
+
+func TestBoltStorage_Expire(t *testing.T) {
+	b, _ := openTestBolt(t, 10)
+	defer b.Close()
+	ctx := context.Background()
+	assert.NoError(t, b.GaugeStorage(ctx, "HeapAlloc", 1.5))
+	assert.NoError(t, b.CountStorage(ctx, "PollCount", 2))
+	before := time.Now()
+	assert.NoError(t, b.CountStorage(ctx, "PollCount", 3))
+
+	deleted, err := b.Expire(ctx, before)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = b.GetGauge(ctx, "HeapAlloc")
+	assert.ErrorIs(t, err, ErrNotFound)
+	d, err := b.GetCount(ctx, "PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), d)
+
+	deleted, err = b.Expire(ctx, time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	gauges, counters, err := ListValues(ctx, b)
+	assert.NoError(t, err)
+	assert.Empty(t, gauges)
+	assert.Empty(t, counters)
+}
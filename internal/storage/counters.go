@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/Nchezhegova/metrics-alerts/internal/log"
+	"go.uber.org/zap"
+)
+
+// SourceHeader is the request header with the id of the agent that reports cumulative counters,
+// gRPC clients send it as metadata
+const SourceHeader = "X-Metrics-Source"
+
+// UpdateReported saves the list. A source reports cumulative counters, they are converted to the deltas
+// by the storage with the last values of the source saved next to the series, see MStorage.UpdateFromSource.
+// Metrics without a source are saved as is.
+func UpdateReported(c context.Context, m MStorage, source string, list []Metrics) error {
+	if source == "" {
+		return m.UpdateBatch(c, list)
+	}
+	return m.UpdateFromSource(c, source, list)
+}
+
+// toDeltas returns a copy of the list where the cumulative counters reported by the source are replaced
+// with their increase since the previous value, prev returns the value saved for the series.
+// A value below the previous one means the source restarted and counts from zero again.
+// The last reported value of every counter is returned to be saved with the update.
+func toDeltas(source string, list []Metrics, prev func(key string) int64) ([]Metrics, map[string]int64) {
+	res := make([]Metrics, len(list))
+	copy(res, list)
+	reported := make(map[string]int64)
+	for i, metric := range list {
+		if metric.MType != config.Counter || metric.Delta == nil {
+			continue
+		}
+		key := metric.Key()
+		last, ok := reported[key]
+		if !ok {
+			last = prev(key)
+		}
+		v := *metric.Delta
+		delta := v - last
+		if v < last {
+			log.Logger.Info("Counter reset", zap.String("source", source), zap.String("key", key),
+				zap.Int64("previous", last), zap.Int64("value", v))
+			delta = v
+		}
+		reported[key] = v
+		res[i].Delta = &delta
+	}
+	return res, reported
+}
+
+// setTotals replaces the counters and histograms of the list with the totals after the update
+func setTotals(list []Metrics, counters map[string]int64, histograms map[string]Histogram) {
+	for i, metric := range list {
+		switch metric.MType {
+		case config.Counter:
+			total := counters[metric.Key()]
+			list[i].Delta = &total
+		case config.Histogram:
+			total := histograms[metric.Key()]
+			list[i].Histogram = &total
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func reportedCounter(id string, v int64) Metrics {
+	return Metrics{ID: id, MType: "counter", Delta: &v}
+}
+
+// testUpdateFromSource reports the cumulative counters to the storage and checks the totals
+func testUpdateFromSource(t *testing.T, m MStorage, id string) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		source string
+		list   []Metrics
+		want   []int64
+	}{
+		{
+			name:   "first report is added whole",
+			source: "agent1",
+			list:   []Metrics{reportedCounter(id, 5)},
+			want:   []int64{5},
+		},
+		{
+			name:   "increase since the last report",
+			source: "agent1",
+			list:   []Metrics{reportedCounter(id, 8)},
+			want:   []int64{8},
+		},
+		{
+			name:   "reset after restart",
+			source: "agent1",
+			list:   []Metrics{reportedCounter(id, 2)},
+			want:   []int64{10},
+		},
+		{
+			name:   "repeated series in one batch",
+			source: "agent1",
+			list:   []Metrics{reportedCounter(id, 4), reportedCounter(id, 7)},
+			want:   []int64{15, 15},
+		},
+		{
+			name:   "sources are independent",
+			source: "agent2",
+			list:   []Metrics{reportedCounter(id, 4)},
+			want:   []int64{19},
+		},
+		{
+			name: "no source keeps deltas",
+			list: []Metrics{reportedCounter(id, 1)},
+			want: []int64{20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, UpdateReported(ctx, m, tt.source, tt.list))
+			var got []int64
+			for _, metric := range tt.list {
+				got = append(got, *metric.Delta)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// удаленный счетчик начинается заново вместе с состоянием источников
+	deleted, err := m.DeleteMetrics(ctx, []Metrics{{ID: id, MType: "counter"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	list := []Metrics{reportedCounter(id, 9)}
+	assert.NoError(t, m.UpdateFromSource(ctx, "agent1", list))
+	assert.Equal(t, int64(9), *list[0].Delta)
+}
+
+func TestMemStorage_UpdateFromSource(t *testing.T) {
+	testUpdateFromSource(t, &MemStorage{}, "PollCount")
+}
+
+func TestBoltStorage_UpdateFromSource(t *testing.T) {
+	b, _ := openTestBolt(t, 10)
+	defer b.Close()
+	testUpdateFromSource(t, b, "PollCount")
+}
+
+func TestDBStorage_UpdateFromSource(t *testing.T) {
+	db := openTestDB(t)
+	testUpdateFromSource(t, NewDBStorage(db, time.Hour), uuid.New().String())
+}
+
+func TestUpdateFromSourceRestart(t *testing.T) {
+	ctx := context.Background()
+	report := func(m MStorage, v int64) int64 {
+		list := []Metrics{reportedCounter("PollCount", v)}
+		assert.NoError(t, m.UpdateFromSource(ctx, "agent1", list))
+		return *list[0].Delta
+	}
+
+	t.Run("wal", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "metrics.wal")
+		m := openTestWAL(t, path)
+		assert.Equal(t, int64(5), report(m, 5))
+
+		restored := openTestWAL(t, path)
+		assert.NoError(t, restored.Replay())
+		assert.Equal(t, int64(8), report(restored, 8))
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		m := &MemStorage{}
+		assert.Equal(t, int64(5), report(m, 5))
+
+		restored := &MemStorage{}
+		restored.SetStartData(m.Snapshot())
+		assert.Equal(t, int64(8), report(restored, 8))
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		b, path := openTestBolt(t, 10)
+		assert.Equal(t, int64(5), report(b, 5))
+		assert.NoError(t, b.Close())
+
+		b, err := OpenBolt(path, 10, time.Hour)
+		assert.NoError(t, err)
+		defer b.Close()
+		assert.Equal(t, int64(8), report(b, 8))
+	})
+}
@@ -3,230 +3,730 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Nchezhegova/metrics-alerts/internal/config"
 	"github.com/Nchezhegova/metrics-alerts/internal/log"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 	"slices"
 	"time"
 )
 
+// DBStorage keeps metrics in Postgres, the tables are created by the migrations
 type DBStorage struct {
-	Name       string  `json:"id"`
-	MetricType string  `json:"type"`
-	Value      float64 `json:"delta,omitempty"`
-	Delta      int64   `json:"value,omitempty"`
+	HistoryRetention time.Duration
+
+	db *sql.DB
 }
 
-var DB *sql.DB
 var retryDelays = []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
 
-func OpenDB(addr string) {
-	var err error
+// DBPool is the connection pool configuration, zero values keep the database/sql defaults
+type DBPool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
 
-	DB, err = sql.Open("postgres", addr)
+// OpenDB connects to the database and migrates it to the latest schema version
+func OpenDB(c context.Context, addr string, pool DBPool) (*sql.DB, error) {
+	db, err := sql.Open("postgres", addr)
 	if err != nil {
-		panic(err)
-	}
-	createTableQuery :=
-		`CREATE TABLE IF NOT EXISTS gauge (
-                      id SERIAL PRIMARY KEY,
-                      name VARCHAR(255) NOT NULL,
-                      value DOUBLE PRECISION NOT NULL);
-		CREATE TABLE IF NOT EXISTS counter (
-                         id SERIAL PRIMARY KEY,
-                         name VARCHAR(255) NOT NULL,
-                         delta BIGINT NOT NULL);`
-	_, err = DB.Exec(createTableQuery)
-	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	if err = db.PingContext(c); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err = Migrate(c, db, LatestVersion); err != nil {
+		db.Close()
+		return nil, err
 	}
+	return db, nil
 }
 
-func CheckConnect(db *sql.DB) error {
-	err := db.Ping()
-	return err
+// NewDBStorage returns the storage that keeps metrics in the database
+func NewDBStorage(db *sql.DB, historyRetention time.Duration) *DBStorage {
+	return &DBStorage{
+		HistoryRetention: historyRetention,
+		db:               db,
+	}
+}
+
+// Close closes the database
+func (d *DBStorage) Close() error {
+	return d.db.Close()
 }
 
-func (d *DBStorage) CountStorage(c context.Context, k string, v int64) {
-	var count int
-	_, err := withRetriesRow(func() (*sql.Row, error) {
-		err := DB.QueryRowContext(c, "SELECT COUNT(*) FROM counter WHERE name = $1", k).Scan(&count)
+// Ping checks the database connection
+func (d *DBStorage) Ping(c context.Context) error {
+	return d.db.PingContext(c)
+}
+
+// Empty reports whether the database has no series
+func (d *DBStorage) Empty(c context.Context) (bool, error) {
+	var empty bool
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		err := d.db.QueryRowContext(c, `SELECT NOT EXISTS (SELECT 1 FROM gauge) AND NOT EXISTS (SELECT 1 FROM counter)
+			AND NOT EXISTS (SELECT 1 FROM histogram)`).Scan(&empty)
 		return nil, err
 	})
-	if err != nil {
-		log.Logger.Info("Error DB:", zap.Error(err))
+	return empty, err
+}
+
+// splitKey splits the series key into the name and the labels as JSON for the labels column
+func splitKey(key string) (string, string) {
+	name, labels := ParseMetricKey(key)
+	if len(labels) == 0 {
+		return name, "{}"
 	}
-	if count > 0 {
-		_, err := withRetriesRow(func() (*sql.Row, error) {
-			_, err := DB.ExecContext(c, "UPDATE counter SET name=$1, delta=delta+$2 WHERE name=$1", k, v)
+	labelsJSON, _ := json.Marshal(labels)
+	return name, string(labelsJSON)
+}
+
+// CountStorage adds to the counter and records the total in one transaction,
+// so a failed request can be retried without counting the delta twice
+func (d *DBStorage) CountStorage(c context.Context, k string, v int64) error {
+	name, labels := splitKey(k)
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		tx, err := d.db.BeginTx(c, nil)
+		if err != nil {
 			return nil, err
-		})
+		}
+		defer tx.Rollback()
+		var total int64
+		err = tx.QueryRowContext(c, `INSERT INTO counter (name, labels, delta) VALUES ($1, $2::jsonb, $3)
+			ON CONFLICT (name, labels) DO UPDATE SET delta = counter.delta + EXCLUDED.delta, updated_at = now() RETURNING delta`, name, labels, v).Scan(&total)
 		if err != nil {
-			log.Logger.Info("Error DB:", zap.Error(err))
+			return nil, err
 		}
-	} else {
-		_, err := withRetriesRow(func() (*sql.Row, error) {
-			_, err := DB.ExecContext(c, "INSERT INTO counter (name, delta) VALUES ($1, $2)", k, v)
+		if err = d.record(c, tx, config.Counter, name, labels, float64(total)); err != nil {
 			return nil, err
-		})
+		}
+		return nil, tx.Commit()
+	})
+	return err
+}
+
+// GaugeStorage saves the gauge and records it in one transaction
+func (d *DBStorage) GaugeStorage(c context.Context, k string, v float64) error {
+	name, labels := splitKey(k)
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		tx, err := d.db.BeginTx(c, nil)
 		if err != nil {
-			log.Logger.Info("Error DB:", zap.Error(err))
+			return nil, err
 		}
+		defer tx.Rollback()
+		_, err = tx.ExecContext(c, `INSERT INTO gauge (name, labels, value) VALUES ($1, $2::jsonb, $3)
+			ON CONFLICT (name, labels) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`, name, labels, v)
+		if err != nil {
+			return nil, err
+		}
+		if err = d.record(c, tx, config.Gauge, name, labels, v); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	})
+	return err
+}
+
+// HistogramStorage merges the observations into the stored histogram
+func (d *DBStorage) HistogramStorage(c context.Context, k string, h Histogram) error {
+	if err := h.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+	}
+	name, labels := splitKey(k)
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		tx, err := d.db.BeginTx(c, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		if _, err = upsertHistogram(c, tx, name, labels, h); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	})
+	return err
+}
+
+// upsertHistogram merges the observations in the transaction and returns the new total.
+// The empty row inserted first gives concurrent writers of a new series one row to lock.
+func upsertHistogram(c context.Context, tx *sql.Tx, name string, labels string, h Histogram) (Histogram, error) {
+	_, err := tx.ExecContext(c, `INSERT INTO histogram (name, labels, buckets, counts, sum, count) VALUES ($1, $2::jsonb, '[]', '[0]', 0, 0)
+		ON CONFLICT (name, labels) DO NOTHING`, name, labels)
+	if err != nil {
+		return Histogram{}, err
+	}
+	old, _, err := getHistogram(c, tx, selectHistogram+" FOR UPDATE", name, labels)
+	if err != nil {
+		return Histogram{}, err
+	}
+	merged := old.Merge(h)
+	buckets, err := json.Marshal(merged.Buckets)
+	if err != nil {
+		return Histogram{}, err
+	}
+	counts, err := json.Marshal(merged.Counts)
+	if err != nil {
+		return Histogram{}, err
+	}
+	_, err = tx.ExecContext(c, "UPDATE histogram SET buckets=$3::jsonb, counts=$4::jsonb, sum=$5, count=$6, updated_at=now() WHERE name=$1 AND labels=$2::jsonb",
+		name, labels, string(buckets), string(counts), merged.Sum, merged.Count)
+	return merged, err
+}
+
+// selectHistogram reads one histogram by name and labels
+const selectHistogram = "SELECT buckets, counts, sum, count FROM histogram WHERE name = $1 AND labels = $2::jsonb"
+
+// rowQueryer is implemented by *sql.DB and *sql.Tx
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getHistogram reads the histogram of the series with the query, exists is false when there is none
+func getHistogram(c context.Context, q rowQueryer, query string, name string, labels string) (Histogram, bool, error) {
+	var h Histogram
+	var buckets, counts []byte
+	err := q.QueryRowContext(c, query, name, labels).Scan(&buckets, &counts, &h.Sum, &h.Count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Histogram{}, false, nil
+	}
+	if err != nil {
+		return Histogram{}, false, err
+	}
+	if err = json.Unmarshal(buckets, &h.Buckets); err != nil {
+		return Histogram{}, false, err
 	}
+	if err = json.Unmarshal(counts, &h.Counts); err != nil {
+		return Histogram{}, false, err
+	}
+	return h, true, nil
 }
 
-func (d *DBStorage) GaugeStorage(c context.Context, k string, v float64) {
-	var count int
-	_, err := withRetriesRow(func() (*sql.Row, error) {
-		err := DB.QueryRowContext(c, "SELECT COUNT(*) FROM gauge WHERE name = $1", k).Scan(&count)
+func (d *DBStorage) GetHistogram(c context.Context, key string) (Histogram, error) {
+	name, labels := splitKey(key)
+	var h Histogram
+	var exists bool
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		var err error
+		h, exists, err = getHistogram(c, d.db, selectHistogram, name, labels)
 		return nil, err
 	})
 	if err != nil {
-		log.Logger.Info("Error DB:", zap.Error(err))
+		return Histogram{}, err
+	}
+	if !exists {
+		return Histogram{}, ErrNotFound
+	}
+	return h, nil
+}
+
+// record adds the value to the samples of the series and drops old samples in the transaction of the update
+func (d *DBStorage) record(c context.Context, tx *sql.Tx, mtype string, name string, labels string, v float64) error {
+	_, err := tx.ExecContext(c, "INSERT INTO samples (type, name, labels, value) VALUES ($1, $2, $3::jsonb, $4)", mtype, name, labels, v)
+	if err != nil || d.HistoryRetention <= 0 {
+		return err
+	}
+	_, err = tx.ExecContext(c, "DELETE FROM samples WHERE type = $1 AND name = $2 AND labels = $3::jsonb AND ts < $4",
+		mtype, name, labels, time.Now().Add(-d.HistoryRetention))
+	return err
+}
+
+func (d *DBStorage) GetRange(c context.Context, mtype string, key string, from time.Time, to time.Time) ([]Sample, error) {
+	name, labels := splitKey(key)
+	res := []Sample{}
+	rows, err := withRetriesRows(c, func() (*sql.Rows, error) {
+		rows, err := d.db.QueryContext(c, "SELECT ts, value FROM samples WHERE type = $1 AND name = $2 AND labels = $3::jsonb AND ts >= $4 AND ts <= $5 ORDER BY ts",
+			mtype, name, labels, from, to)
+		return rows, err
+	})
+	if err != nil {
+		return nil, err
 	}
-	if count > 0 {
-		_, err := withRetriesRow(func() (*sql.Row, error) {
-			_, err := DB.ExecContext(c, "UPDATE gauge SET name=$1, value=$2 WHERE name=$1", k, v)
+	defer rows.Close()
+	for rows.Next() {
+		var sample Sample
+		if err := rows.Scan(&sample.Time, &sample.Value); err != nil {
 			return nil, err
-		})
-		if err != nil {
-			log.Logger.Info("Error DB:", zap.Error(err))
 		}
-	} else {
-		_, err := withRetriesRow(func() (*sql.Row, error) {
-			_, err := DB.ExecContext(c, "INSERT INTO gauge (name, value) VALUES ($1, $2)", k, v)
+		res = append(res, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetStorage returns all metrics and silences as Snapshot
+func (d *DBStorage) GetStorage(c context.Context) (Snapshot, error) {
+	return d.Snapshot(c)
+}
+
+// scanLabels decodes the labels column, empty labels are returned as nil
+func scanLabels(labelsJSON []byte) map[string]string {
+	var labels map[string]string
+	if err := json.Unmarshal(labelsJSON, &labels); err != nil {
+		log.Logger.Info("Error convert from JSON:", zap.Error(err))
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// SetStartData writes the restored metrics and silences into the database, existing series are overwritten
+func (d *DBStorage) SetStartData(storage Snapshot) {
+	if err := d.Restore(context.Background(), storage); err != nil {
+		log.Logger.Info("Error restoring database storage:", zap.Error(err))
+	}
+}
+
+// restoreQuery overwrites the gauges and counters of a snapshot in one statement
+const restoreQuery = `WITH g AS (
+    INSERT INTO gauge (name, labels, value)
+    SELECT * FROM unnest($1::text[], $2::jsonb[], $3::float8[])
+    ON CONFLICT (name, labels) DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+)
+INSERT INTO counter (name, labels, delta)
+SELECT * FROM unnest($4::text[], $5::jsonb[], $6::int8[])
+ON CONFLICT (name, labels) DO UPDATE SET delta = EXCLUDED.delta, updated_at = now()`
+
+// Restore writes the snapshot in one transaction, existing series and silences are overwritten
+func (d *DBStorage) Restore(c context.Context, data Snapshot) error {
+	var gaugeNames, gaugeLabels, counterNames, counterLabels []string
+	var gaugeValues []float64
+	var counterDeltas []int64
+	for key, v := range data.Gauge {
+		name, labels := splitKey(key)
+		gaugeNames, gaugeLabels, gaugeValues = append(gaugeNames, name), append(gaugeLabels, labels), append(gaugeValues, v)
+	}
+	for key, v := range data.Counter {
+		name, labels := splitKey(key)
+		counterNames, counterLabels, counterDeltas = append(counterNames, name), append(counterLabels, labels), append(counterDeltas, v)
+	}
+
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		tx, err := d.db.BeginTx(c, nil)
+		if err != nil {
 			return nil, err
-		})
+		}
+		defer tx.Rollback()
+		_, err = tx.ExecContext(c, restoreQuery,
+			pq.Array(gaugeNames), pq.Array(gaugeLabels), pq.Array(gaugeValues),
+			pq.Array(counterNames), pq.Array(counterLabels), pq.Array(counterDeltas))
 		if err != nil {
-			log.Logger.Info("Error DB:", zap.Error(err))
+			return nil, err
 		}
-	}
+		for key, h := range data.Histograms {
+			name, labels := splitKey(key)
+			buckets, err := json.Marshal(h.Buckets)
+			if err != nil {
+				return nil, err
+			}
+			counts, err := json.Marshal(h.Counts)
+			if err != nil {
+				return nil, err
+			}
+			_, err = tx.ExecContext(c, `INSERT INTO histogram (name, labels, buckets, counts, sum, count) VALUES ($1, $2::jsonb, $3::jsonb, $4::jsonb, $5, $6)
+				ON CONFLICT (name, labels) DO UPDATE SET buckets = EXCLUDED.buckets, counts = EXCLUDED.counts, sum = EXCLUDED.sum, count = EXCLUDED.count, updated_at = now()`,
+				name, labels, string(buckets), string(counts), h.Sum, h.Count)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for key, sources := range data.Reported {
+			name, labels := splitKey(key)
+			for source, v := range sources {
+				_, err = tx.ExecContext(c, `INSERT INTO counter_sources (name, labels, source, value) VALUES ($1, $2::jsonb, $3, $4)
+					ON CONFLICT (name, labels, source) DO UPDATE SET value = EXCLUDED.value`, name, labels, source, v)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, silence := range data.Silences {
+			_, err = tx.ExecContext(c, `INSERT INTO silences (id, matcher, starts_at, ends_at, comment, created_by) VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (id) DO UPDATE SET matcher = EXCLUDED.matcher, starts_at = EXCLUDED.starts_at, ends_at = EXCLUDED.ends_at,
+				comment = EXCLUDED.comment, created_by = EXCLUDED.created_by`,
+				silence.ID, silence.Matcher, silence.StartsAt, silence.EndsAt, silence.Comment, silence.CreatedBy)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, tx.Commit()
+	})
+	return err
 }
 
-func (d *DBStorage) GetStorage(c context.Context) interface{} {
-	arrd := []DBStorage{}
-	rows, err := withRetriesRows(func() (*sql.Rows, error) {
-		rows, err := DB.QueryContext(c, "SELECT name, value FROM gauge")
-		return rows, err
+// Snapshot reads all metrics and silences of the database
+func (d *DBStorage) Snapshot(c context.Context) (Snapshot, error) {
+	res := Snapshot{
+		Gauge:      make(map[string]float64),
+		Counter:    make(map[string]int64),
+		Histograms: make(map[string]Histogram),
+		Silences:   make(map[string]Silence),
+	}
+	gauges, err := withRetriesRows(c, func() (*sql.Rows, error) {
+		return d.db.QueryContext(c, "SELECT name, labels, value FROM gauge")
 	})
+	if err != nil {
+		return res, err
+	}
+	defer gauges.Close()
+	for gauges.Next() {
+		var name string
+		var labels []byte
+		var v float64
+		if err := gauges.Scan(&name, &labels, &v); err != nil {
+			return res, err
+		}
+		res.Gauge[MetricKey(name, scanLabels(labels))] = v
+	}
+	if err := gauges.Err(); err != nil {
+		return res, err
+	}
 
+	counters, err := withRetriesRows(c, func() (*sql.Rows, error) {
+		return d.db.QueryContext(c, "SELECT name, labels, delta FROM counter")
+	})
 	if err != nil {
-		log.Logger.Info("Error DB:", zap.Error(err))
+		return res, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		if err := rows.Scan(&d.Name, &d.Value); err != nil {
-			log.Logger.Info("Error DB:", zap.Error(err))
+	defer counters.Close()
+	for counters.Next() {
+		var name string
+		var labels []byte
+		var v int64
+		if err := counters.Scan(&name, &labels, &v); err != nil {
+			return res, err
 		}
-		d.MetricType = config.Gauge
-		arrd = append(arrd, *d)
+		res.Counter[MetricKey(name, scanLabels(labels))] = v
 	}
-	row, _ := withRetriesRow(func() (*sql.Row, error) {
-		row := DB.QueryRowContext(c, "SELECT name, delta FROM counter")
-		return row, nil
+	if err := counters.Err(); err != nil {
+		return res, err
+	}
+
+	histograms, err := withRetriesRows(c, func() (*sql.Rows, error) {
+		return d.db.QueryContext(c, "SELECT name, labels, buckets, counts, sum, count FROM histogram")
 	})
-	if err := row.Scan(&d.Name, &d.Delta); err != nil {
-		log.Logger.Info("Error DB:", zap.Error(err))
-	} else {
-		d.MetricType = config.Counter
-		arrd = append(arrd, *d)
+	if err != nil {
+		return res, err
 	}
-	if err := rows.Err(); err != nil {
-		log.Logger.Info("Error DB:", zap.Error(err))
+	defer histograms.Close()
+	for histograms.Next() {
+		var name string
+		var h Histogram
+		var labels, buckets, counts []byte
+		if err := histograms.Scan(&name, &labels, &buckets, &counts, &h.Sum, &h.Count); err != nil {
+			return res, err
+		}
+		if err := errors.Join(json.Unmarshal(buckets, &h.Buckets), json.Unmarshal(counts, &h.Counts)); err != nil {
+			return res, err
+		}
+		res.Histograms[MetricKey(name, scanLabels(labels))] = h
+	}
+	if err := histograms.Err(); err != nil {
+		return res, err
+	}
+
+	reported, err := withRetriesRows(c, func() (*sql.Rows, error) {
+		return d.db.QueryContext(c, "SELECT name, labels, source, value FROM counter_sources")
+	})
+	if err != nil {
+		return res, err
+	}
+	defer reported.Close()
+	for reported.Next() {
+		var name, source string
+		var labels []byte
+		var v int64
+		if err := reported.Scan(&name, &labels, &source, &v); err != nil {
+			return res, err
+		}
+		if res.Reported == nil {
+			res.Reported = make(map[string]map[string]int64)
+		}
+		key := MetricKey(name, scanLabels(labels))
+		if res.Reported[key] == nil {
+			res.Reported[key] = make(map[string]int64)
+		}
+		res.Reported[key][source] = v
+	}
+	if err := reported.Err(); err != nil {
+		return res, err
 	}
-	return arrd
-}
 
-func (d *DBStorage) SetStartData(storage MemStorage) {
+	silences, err := d.GetSilences(c)
+	if err != nil {
+		return res, err
+	}
+	for _, silence := range silences {
+		res.Silences[silence.ID] = silence
+	}
+	return res, nil
+}
 
+func (d *DBStorage) GetGauge(c context.Context, key string) (float64, error) {
+	name, labels := splitKey(key)
+	var v float64
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		err := d.db.QueryRowContext(c, "SELECT value FROM gauge WHERE name = $1 AND labels = $2::jsonb", name, labels).Scan(&v)
+		return nil, err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return v, err
 }
 
-func (d *DBStorage) GetGauge(c context.Context, key string) (float64, bool) {
-	var exists bool
-	var count int
-	_, err := withRetriesRow(func() (*sql.Row, error) {
-		err := DB.QueryRowContext(c, "SELECT COUNT(*) FROM gauge WHERE name = $1", key).Scan(&count)
+func (d *DBStorage) GetCount(c context.Context, key string) (int64, error) {
+	name, labels := splitKey(key)
+	var v int64
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		err := d.db.QueryRowContext(c, "SELECT delta FROM counter WHERE name = $1 AND labels = $2::jsonb", name, labels).Scan(&v)
 		return nil, err
 	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return v, err
+}
+
+// UpdateBatch applies all metrics in one transaction or none of them.
+// Counters and histograms in the list are replaced with the totals after the update.
+func (d *DBStorage) UpdateBatch(c context.Context, list []Metrics) error {
+	batch, err := newDBBatch(list)
 	if err != nil {
-		log.Logger.Info("Error DB:", zap.Error(err))
+		return err
 	}
-	if count > 0 {
-		row, _ := withRetriesRow(func() (*sql.Row, error) {
-			row := DB.QueryRowContext(c, "SELECT value FROM gauge WHERE name = $1", key)
-			return row, nil
-		})
-		err = row.Scan(&d.Value)
+	_, err = withRetriesRow(c, func() (*sql.Row, error) {
+		return nil, d.applyBatch(c, batch)
+	})
+	if err != nil {
+		return err
+	}
+	setTotals(list, batch.counterTotals, batch.histogramTotals)
+	return nil
+}
+
+// reportQuery saves the last cumulative values of the counters reported by the source $1
+const reportQuery = `INSERT INTO counter_sources (name, labels, source, value)
+SELECT name, labels, $1, value FROM unnest($2::text[], $3::jsonb[], $4::int8[]) AS r(name, labels, value)
+ON CONFLICT (name, labels, source) DO UPDATE SET value = EXCLUDED.value`
+
+// UpdateFromSource saves the list with the counters reported by the source as cumulative values.
+// The updates of a source are serialised by an advisory lock, so every increase is counted once
+// by all instances of the server. The increase and the last values of the source are written in one transaction.
+func (d *DBStorage) UpdateFromSource(c context.Context, source string, list []Metrics) error {
+	for _, metric := range list {
+		if err := metric.Validate(); err != nil {
+			return err
+		}
+	}
+	var batch *dbBatch
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		tx, err := d.db.BeginTx(c, nil)
 		if err != nil {
-			log.Logger.Info("Error DB:", zap.Error(err))
+			return nil, err
+		}
+		defer tx.Rollback()
+		if _, err = tx.ExecContext(c, "SELECT pg_advisory_xact_lock(hashtext($1))", source); err != nil {
+			return nil, err
 		}
-		exists = true
+		prev, err := reportedValues(c, tx, source)
+		if err != nil {
+			return nil, err
+		}
+		deltas, reported := toDeltas(source, list, func(key string) int64 {
+			return prev[key]
+		})
+		if batch, err = newDBBatch(deltas); err != nil {
+			return nil, err
+		}
+		if err = d.writeBatch(c, tx, batch); err != nil {
+			return nil, err
+		}
+		var names, labels []string
+		var values []int64
+		for key, v := range reported {
+			name, l := splitKey(key)
+			names, labels, values = append(names, name), append(labels, l), append(values, v)
+		}
+		if _, err = tx.ExecContext(c, reportQuery, source, pq.Array(names), pq.Array(labels), pq.Array(values)); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	})
+	if err != nil {
+		return err
 	}
-	return d.Value, exists
+	setTotals(list, batch.counterTotals, batch.histogramTotals)
+	return nil
 }
 
-func (d *DBStorage) GetCount(c context.Context, key string) (int64, bool) {
-	var exists bool
-	var count int
-	_, err := withRetriesRow(func() (*sql.Row, error) {
-		err := DB.QueryRowContext(c, "SELECT COUNT(*) FROM counter WHERE name = $1", key).Scan(&count)
+// reportedValues reads the last values of the counters reported by the source
+func reportedValues(c context.Context, tx *sql.Tx, source string) (map[string]int64, error) {
+	rows, err := tx.QueryContext(c, "SELECT name, labels, value FROM counter_sources WHERE source = $1", source)
+	if err != nil {
 		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var labels []byte
+		var v int64
+		if err := rows.Scan(&name, &labels, &v); err != nil {
+			return nil, err
+		}
+		res[MetricKey(name, scanLabels(labels))] = v
+	}
+	return res, rows.Err()
+}
+
+func (d *DBStorage) AddSilence(c context.Context, silence Silence) error {
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		_, err := d.db.ExecContext(c, "INSERT INTO silences (id, matcher, starts_at, ends_at, comment, created_by) VALUES ($1, $2, $3, $4, $5, $6)",
+			silence.ID, silence.Matcher, silence.StartsAt, silence.EndsAt, silence.Comment, silence.CreatedBy)
+		return nil, err
+	})
+	return err
+}
+
+func (d *DBStorage) GetSilences(c context.Context) ([]Silence, error) {
+	res := []Silence{}
+	rows, err := withRetriesRows(c, func() (*sql.Rows, error) {
+		rows, err := d.db.QueryContext(c, "SELECT id, matcher, starts_at, ends_at, comment, created_by FROM silences ORDER BY starts_at")
+		return rows, err
 	})
 	if err != nil {
-		log.Logger.Info("Error DB:", zap.Error(err))
+		return nil, err
 	}
-	if count > 0 {
-		row, _ := withRetriesRow(func() (*sql.Row, error) {
-			row := DB.QueryRowContext(c, "SELECT delta FROM counter WHERE name = $1", key)
-			return row, nil
-		})
-		err := row.Scan(&d.Delta)
-		if err != nil {
-			log.Logger.Info("Error DB:", zap.Error(err))
-		}
-		if d.Delta > 0 {
-			exists = true
+	defer rows.Close()
+	for rows.Next() {
+		var silence Silence
+		if err := rows.Scan(&silence.ID, &silence.Matcher, &silence.StartsAt, &silence.EndsAt, &silence.Comment, &silence.CreatedBy); err != nil {
+			return nil, err
 		}
+		res = append(res, silence)
 	}
-	return d.Delta, exists
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
-func (d *DBStorage) UpdateBatch(c context.Context, list []Metrics) error {
-	tx, err := DB.Begin()
+func (d *DBStorage) DeleteSilence(c context.Context, id string) (bool, error) {
+	var affected int64
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		res, err := d.db.ExecContext(c, "DELETE FROM silences WHERE id = $1", id)
+		if err != nil {
+			return nil, err
+		}
+		affected, err = res.RowsAffected()
+		return nil, err
+	})
 	if err != nil {
-		log.Logger.Info("Error DB:", zap.Error(err))
+		return false, err
 	}
+	return affected > 0, nil
+}
+
+// DeleteMetrics removes the series of the metrics with their samples and reported values in one transaction
+// and returns how many of them existed
+func (d *DBStorage) DeleteMetrics(c context.Context, list []Metrics) (int, error) {
 	for _, metric := range list {
-		switch metric.MType {
-		case config.Gauge:
-			k := metric.ID
-			v := metric.Value
-			d.GaugeStorage(c, k, *v)
-
-		case config.Counter:
-			k := metric.ID
-			v := metric.Delta
-			d.CountStorage(c, k, *v)
-			vNew, _ := d.GetCount(c, metric.ID)
-			metric.Delta = &vNew
-		default:
-			tx.Rollback()
-			err = fmt.Errorf("unknowning metric type")
-			return err
+		if err := metric.ValidateSeries(); err != nil {
+			return 0, err
 		}
 	}
-	err = tx.Commit()
+	var deleted int
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		tx, err := d.db.BeginTx(c, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		deleted = 0
+		for _, metric := range list {
+			name, labels := splitKey(metric.Key())
+			// имя таблицы совпадает с типом, тип проверен в ValidateSeries
+			res, err := tx.ExecContext(c, "DELETE FROM "+metric.MType+" WHERE name = $1 AND labels = $2::jsonb", name, labels)
+			if err != nil {
+				return nil, err
+			}
+			affected, err := res.RowsAffected()
+			if err != nil {
+				return nil, err
+			}
+			deleted += int(affected)
+			_, err = tx.ExecContext(c, "DELETE FROM samples WHERE type = $1 AND name = $2 AND labels = $3::jsonb", metric.MType, name, labels)
+			if err != nil {
+				return nil, err
+			}
+			if metric.MType == config.Counter {
+				_, err = tx.ExecContext(c, "DELETE FROM counter_sources WHERE name = $1 AND labels = $2::jsonb", name, labels)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, tx.Commit()
+	})
 	if err != nil {
-		log.Logger.Info("Error DB:", zap.Error(err))
+		return 0, err
 	}
-	return nil
+	return deleted, nil
 }
 
-func withRetriesRow(operation func() (*sql.Row, error)) (*sql.Row, error) {
+// Expire removes the series that were not updated since the time with their samples and returns their number
+func (d *DBStorage) Expire(c context.Context, before time.Time) (int, error) {
+	var deleted int
+	_, err := withRetriesRow(c, func() (*sql.Row, error) {
+		tx, err := d.db.BeginTx(c, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		deleted = 0
+		_, err = tx.ExecContext(c, "DELETE FROM counter_sources s USING counter t WHERE s.name = t.name AND s.labels = t.labels AND t.updated_at < $1",
+			before)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range []string{config.Gauge, config.Counter, config.Histogram} {
+			_, err = tx.ExecContext(c, "DELETE FROM samples s USING "+table+" t WHERE s.type = $1 AND s.name = t.name AND s.labels = t.labels AND t.updated_at < $2",
+				table, before)
+			if err != nil {
+				return nil, err
+			}
+			res, err := tx.ExecContext(c, "DELETE FROM "+table+" WHERE updated_at < $1", before)
+			if err != nil {
+				return nil, err
+			}
+			affected, err := res.RowsAffected()
+			if err != nil {
+				return nil, err
+			}
+			deleted += int(affected)
+		}
+		return nil, tx.Commit()
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+func withRetriesRow(c context.Context, operation func() (*sql.Row, error)) (*sql.Row, error) {
 	selectedErr := []string{pgerrcode.UniqueViolation, pgerrcode.ConnectionException, pgerrcode.ConnectionDoesNotExist,
 		pgerrcode.ConnectionFailure, pgerrcode.SQLClientUnableToEstablishSQLConnection,
 		pgerrcode.SQLServerRejectedEstablishmentOfSQLConnection,
@@ -239,7 +739,9 @@ func withRetriesRow(operation func() (*sql.Row, error)) (*sql.Row, error) {
 		}
 		if pgErr, ok := err.(*pgconn.PgError); ok {
 			if slices.Contains(selectedErr, pgErr.Code) {
-				time.Sleep(retryDelays[i])
+				if err := sleepContext(c, retryDelays[i]); err != nil {
+					return nil, err
+				}
 				continue
 			}
 		}
@@ -249,7 +751,7 @@ func withRetriesRow(operation func() (*sql.Row, error)) (*sql.Row, error) {
 }
 
 // Отдельная функция чтобы избежать ошибки "rows.Err must be checked" в go vet. Возникает когда не должно быть rows
-func withRetriesRows(operation func() (*sql.Rows, error)) (*sql.Rows, error) {
+func withRetriesRows(c context.Context, operation func() (*sql.Rows, error)) (*sql.Rows, error) {
 	selectedErr := []string{pgerrcode.UniqueViolation, pgerrcode.ConnectionException, pgerrcode.ConnectionDoesNotExist,
 		pgerrcode.ConnectionFailure, pgerrcode.SQLClientUnableToEstablishSQLConnection,
 		pgerrcode.SQLServerRejectedEstablishmentOfSQLConnection,
@@ -262,7 +764,9 @@ func withRetriesRows(operation func() (*sql.Rows, error)) (*sql.Rows, error) {
 		}
 		if pgErr, ok := err.(*pgconn.PgError); ok {
 			if slices.Contains(selectedErr, pgErr.Code) {
-				time.Sleep(retryDelays[i])
+				if err := sleepContext(c, retryDelays[i]); err != nil {
+					return nil, err
+				}
 				continue
 			}
 		}
@@ -270,3 +774,15 @@ func withRetriesRows(operation func() (*sql.Rows, error)) (*sql.Rows, error) {
 	}
 	return nil, fmt.Errorf("max retries")
 }
+
+// sleepContext waits for the delay and returns the context error when it is done earlier
+func sleepContext(c context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-c.Done():
+		return c.Err()
+	case <-timer.C:
+		return nil
+	}
+}
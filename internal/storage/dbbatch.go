@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/lib/pq"
+)
+
+// upsertBatchQuery writes all gauges and counters of a batch and their samples in one statement.
+// $7 is the history retention in seconds, old samples of the series of the batch are deleted when it is positive,
+// like DBStorage.record does for a single update.
+const upsertBatchQuery = `WITH g AS (
+    INSERT INTO gauge (name, labels, value)
+    SELECT * FROM unnest($1::text[], $2::jsonb[], $3::float8[])
+    ON CONFLICT (name, labels) DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+    RETURNING name, labels, value
+), c AS (
+    INSERT INTO counter (name, labels, delta)
+    SELECT * FROM unnest($4::text[], $5::jsonb[], $6::int8[])
+    ON CONFLICT (name, labels) DO UPDATE SET delta = counter.delta + EXCLUDED.delta, updated_at = now()
+    RETURNING name, labels, delta
+), s AS (
+    INSERT INTO samples (type, name, labels, value)
+    SELECT 'gauge', name, labels, value FROM g
+    UNION ALL
+    SELECT 'counter', name, labels, delta FROM c
+), old AS (
+    DELETE FROM samples o USING (
+        SELECT 'gauge' AS type, name, labels FROM g
+        UNION ALL
+        SELECT 'counter', name, labels FROM c
+    ) b
+    WHERE $7::float8 > 0 AND o.type = b.type AND o.name = b.name AND o.labels = b.labels
+        AND o.ts < now() - $7::float8 * interval '1 second'
+)
+SELECT name, labels, delta FROM c`
+
+// dbBatch is an UpdateBatch call prepared for upsertBatchQuery.
+// A series may appear only once in one upsert, so repeated gauges keep the last value
+// and repeated counters and histograms are summed.
+type dbBatch struct {
+	gaugeNames    []string
+	gaugeLabels   []string
+	gaugeValues   []float64
+	counterNames  []string
+	counterLabels []string
+	counterDeltas []int64
+
+	histogramKeys   []string
+	histograms      map[string]Histogram
+	counterTotals   map[string]int64
+	histogramTotals map[string]Histogram
+}
+
+// newDBBatch validates the metrics and groups them by series
+func newDBBatch(list []Metrics) (*dbBatch, error) {
+	b := &dbBatch{
+		histograms:      make(map[string]Histogram),
+		counterTotals:   make(map[string]int64),
+		histogramTotals: make(map[string]Histogram),
+	}
+	gauges := make(map[string]int)
+	counters := make(map[string]int)
+	for _, metric := range list {
+		if err := metric.Validate(); err != nil {
+			return nil, err
+		}
+		key := metric.Key()
+		name, labels := splitKey(key)
+		switch metric.MType {
+		case config.Gauge:
+			if i, exists := gauges[key]; exists {
+				b.gaugeValues[i] = *metric.Value
+				continue
+			}
+			gauges[key] = len(b.gaugeNames)
+			b.gaugeNames = append(b.gaugeNames, name)
+			b.gaugeLabels = append(b.gaugeLabels, labels)
+			b.gaugeValues = append(b.gaugeValues, *metric.Value)
+		case config.Counter:
+			if i, exists := counters[key]; exists {
+				b.counterDeltas[i] += *metric.Delta
+				continue
+			}
+			counters[key] = len(b.counterNames)
+			b.counterNames = append(b.counterNames, name)
+			b.counterLabels = append(b.counterLabels, labels)
+			b.counterDeltas = append(b.counterDeltas, *metric.Delta)
+		case config.Histogram:
+			if _, exists := b.histograms[key]; !exists {
+				b.histogramKeys = append(b.histogramKeys, key)
+			}
+			b.histograms[key] = b.histograms[key].Merge(*metric.Histogram)
+		}
+	}
+	return b, nil
+}
+
+// applyBatch writes the batch in one transaction and saves the totals into the batch
+func (d *DBStorage) applyBatch(c context.Context, b *dbBatch) error {
+	tx, err := d.db.BeginTx(c, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = d.writeBatch(c, tx, b); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeBatch writes the batch in the transaction and saves the totals into the batch
+func (d *DBStorage) writeBatch(c context.Context, tx *sql.Tx, b *dbBatch) error {
+	rows, err := tx.QueryContext(c, upsertBatchQuery,
+		pq.Array(b.gaugeNames), pq.Array(b.gaugeLabels), pq.Array(b.gaugeValues),
+		pq.Array(b.counterNames), pq.Array(b.counterLabels), pq.Array(b.counterDeltas),
+		d.HistoryRetention.Seconds())
+	if err != nil {
+		return err
+	}
+	if err = scanCounterTotals(rows, b.counterTotals); err != nil {
+		return err
+	}
+
+	for _, key := range b.histogramKeys {
+		name, labels := splitKey(key)
+		total, err := upsertHistogram(c, tx, name, labels, b.histograms[key])
+		if err != nil {
+			return err
+		}
+		b.histogramTotals[key] = total
+	}
+	return nil
+}
+
+// scanCounterTotals reads the counters returned by upsertBatchQuery and closes the rows
+func scanCounterTotals(rows *sql.Rows, totals map[string]int64) error {
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var labels []byte
+		var total int64
+		if err := rows.Scan(&name, &labels, &total); err != nil {
+			return err
+		}
+		totals[MetricKey(name, scanLabels(labels))] = total
+	}
+	return rows.Err()
+}
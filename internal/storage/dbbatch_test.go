@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewDBBatch(t *testing.T) {
+	var v1, v2 = 1.5, 2.5
+	var d1, d2 int64 = 3, 4
+	h := NewHistogram([]float64{1})
+	h.Observe(0.5)
+	labels := map[string]string{"host": "web1"}
+
+	b, err := newDBBatch([]Metrics{
+		{ID: "load", MType: "gauge", Value: &v1},
+		{ID: "load", MType: "gauge", Value: &v2},
+		{ID: "load", MType: "gauge", Value: &v1, Labels: labels},
+		{ID: "requests", MType: "counter", Delta: &d1},
+		{ID: "requests", MType: "counter", Delta: &d2},
+		{ID: "latency", MType: "histogram", Histogram: &h},
+		{ID: "latency", MType: "histogram", Histogram: &h},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"load", "load"}, b.gaugeNames)
+	assert.Equal(t, []string{"{}", `{"host":"web1"}`}, b.gaugeLabels)
+	assert.Equal(t, []float64{2.5, 1.5}, b.gaugeValues)
+	assert.Equal(t, []string{"requests"}, b.counterNames)
+	assert.Equal(t, []int64{7}, b.counterDeltas)
+	assert.Equal(t, []string{"latency"}, b.histogramKeys)
+	assert.Equal(t, uint64(2), b.histograms["latency"].Count)
+
+	_, err = newDBBatch([]Metrics{{ID: "load", MType: "summary"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,11 @@
+package storage
+
+import (
+	"errors"
+)
+
+// ErrNotFound is returned when the storage has no such metric series
+var ErrNotFound = errors.New("metric not found")
+
+// ErrInvalidMetric is returned for a metric the storage cannot accept
+var ErrInvalidMetric = errors.New("invalid metric")
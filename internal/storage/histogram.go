@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// DefaultBuckets are the upper bounds used by NewHistogram when none are given
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultQuantiles are estimated on read when the request does not name any
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Histogram counts observations in buckets with the given upper bounds.
+// Counts has one more element than Buckets, the last one is for observations above the greatest bound.
+type Histogram struct {
+	Buckets   []float64          `json:"buckets"`
+	Counts    []uint64           `json:"counts"`
+	Sum       float64            `json:"sum"`
+	Count     uint64             `json:"count"`
+	Quantiles map[string]float64 `json:"quantiles,omitempty"` // оценка квантилей, заполняется только при чтении
+}
+
+// NewHistogram returns an empty histogram with the bucket bounds
+func NewHistogram(buckets []float64) Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return Histogram{
+		Buckets: append([]float64(nil), buckets...),
+		Counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+// Observe adds one value to the histogram
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.Buckets, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// Validate checks that the bounds are sorted and the counts agree with them
+func (h Histogram) Validate() error {
+	for i, b := range h.Buckets {
+		if math.IsNaN(b) || math.IsInf(b, 0) {
+			return fmt.Errorf("invalid histogram bucket %v", b)
+		}
+		if i > 0 && b <= h.Buckets[i-1] {
+			return fmt.Errorf("histogram buckets are not sorted")
+		}
+	}
+	if len(h.Counts) != len(h.Buckets)+1 {
+		return fmt.Errorf("histogram has %d counts for %d buckets", len(h.Counts), len(h.Buckets))
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("histogram count %d does not match the bucket counts %d", h.Count, total)
+	}
+	return nil
+}
+
+// Merge returns the sum of both histograms.
+// When the bounds differ, the result keeps only the bounds present in both, so every count stays in a correct bucket.
+// An empty histogram takes the bounds of the other one.
+func (h Histogram) Merge(other Histogram) Histogram {
+	if h.Count == 0 {
+		return other.rebucket(other.Buckets)
+	}
+	if other.Count == 0 {
+		return h.rebucket(h.Buckets)
+	}
+	var bounds []float64
+	for _, b := range h.Buckets {
+		i := sort.SearchFloat64s(other.Buckets, b)
+		if i < len(other.Buckets) && other.Buckets[i] == b {
+			bounds = append(bounds, b)
+		}
+	}
+	res := h.rebucket(bounds)
+	add := other.rebucket(bounds)
+	for i := range res.Counts {
+		res.Counts[i] += add.Counts[i]
+	}
+	res.Sum += add.Sum
+	res.Count += add.Count
+	return res
+}
+
+// rebucket returns a copy of the histogram with the bounds, they must be a subset of the histogram bounds
+func (h Histogram) rebucket(bounds []float64) Histogram {
+	res := Histogram{
+		Buckets: append([]float64(nil), bounds...),
+		Counts:  make([]uint64, len(bounds)+1),
+		Sum:     h.Sum,
+		Count:   h.Count,
+	}
+	for i, c := range h.Counts {
+		j := len(bounds)
+		if i < len(h.Buckets) {
+			j = sort.SearchFloat64s(bounds, h.Buckets[i])
+		}
+		res.Counts[j] += c
+	}
+	return res
+}
+
+// Quantile estimates the q-quantile by linear interpolation inside the bucket.
+// Values above the greatest bound are estimated as that bound, NaN is returned for an empty histogram.
+func (h Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 || q < 0 || q > 1 || len(h.Buckets) == 0 {
+		return math.NaN()
+	}
+	rank := q * float64(h.Count)
+	var cumulative float64
+	for i, b := range h.Buckets {
+		prev := cumulative
+		cumulative += float64(h.Counts[i])
+		if cumulative < rank || h.Counts[i] == 0 {
+			continue
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.Buckets[i-1]
+		} else if b <= 0 {
+			return b
+		}
+		return lower + (b-lower)*(rank-prev)/float64(h.Counts[i])
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+// WithQuantiles returns a copy of the histogram with the estimated quantiles filled in
+func (h Histogram) WithQuantiles(qs []float64) Histogram {
+	h.Quantiles = make(map[string]float64, len(qs))
+	for _, q := range qs {
+		if v := h.Quantile(q); !math.IsNaN(v) {
+			h.Quantiles[strconv.FormatFloat(q, 'g', -1, 64)] = v
+		}
+	}
+	return h
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	h := NewHistogram([]float64{1, 5})
+	for _, v := range []float64{0.5, 1, 2, 10} {
+		h.Observe(v)
+	}
+	assert.Equal(t, []uint64{2, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(4), h.Count)
+	assert.Equal(t, 13.5, h.Sum)
+	assert.NoError(t, h.Validate())
+
+	assert.Equal(t, DefaultBuckets, NewHistogram(nil).Buckets)
+}
+
+func TestHistogram_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		h    Histogram
+	}{
+		{name: "unsorted buckets", h: Histogram{Buckets: []float64{2, 1}, Counts: []uint64{0, 0, 0}}},
+		{name: "infinite bucket", h: Histogram{Buckets: []float64{math.Inf(1)}, Counts: []uint64{0, 0}}},
+		{name: "counts length", h: Histogram{Buckets: []float64{1}, Counts: []uint64{1}, Count: 1}},
+		{name: "count mismatch", h: Histogram{Buckets: []float64{1}, Counts: []uint64{1, 1}, Count: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.h.Validate())
+		})
+	}
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	a := NewHistogram([]float64{1, 2, 5})
+	b := NewHistogram([]float64{1, 5, 10})
+	for _, v := range []float64{0.5, 1.5, 3} {
+		a.Observe(v)
+	}
+	for _, v := range []float64{4, 7, 20} {
+		b.Observe(v)
+	}
+
+	res := Histogram{}.Merge(a)
+	assert.Equal(t, a, res)
+
+	res = a.Merge(b)
+	assert.Equal(t, []float64{1, 5}, res.Buckets)
+	assert.Equal(t, []uint64{1, 3, 2}, res.Counts)
+	assert.Equal(t, uint64(6), res.Count)
+	assert.Equal(t, 36.0, res.Sum)
+	assert.NoError(t, res.Validate())
+	assert.Equal(t, []uint64{1, 1, 1, 0}, a.Counts, "Expected the merged histograms to stay unchanged")
+}
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := Histogram{Buckets: []float64{1, 2, 4}, Counts: []uint64{2, 2, 4, 0}, Count: 8}
+	assert.Equal(t, 0.5, h.Quantile(0.125))
+	assert.Equal(t, 1.5, h.Quantile(0.375))
+	assert.Equal(t, 3.0, h.Quantile(0.75))
+	assert.Equal(t, 4.0, h.Quantile(1))
+
+	h = Histogram{Buckets: []float64{1}, Counts: []uint64{0, 5}, Count: 5}
+	assert.Equal(t, 1.0, h.Quantile(0.5), "Expected the greatest bound for the overflow bucket")
+	assert.True(t, math.IsNaN(Histogram{Buckets: []float64{1}, Counts: []uint64{0, 0}}.Quantile(0.5)))
+
+	res := h.WithQuantiles([]float64{0.5, 0.99})
+	assert.Equal(t, map[string]float64{"0.5": 1, "0.99": 1}, res.Quantiles)
+	assert.Nil(t, h.Quantiles)
+}
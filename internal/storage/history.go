@@ -0,0 +1,65 @@
+package storage
+
+import "time"
+
+// DefaultHistorySize is the number of samples kept per series in memory when no size is set
+const DefaultHistorySize = 1000
+
+// Sample is one recorded value of a metric
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"` // для counter хранится накопленное значение
+}
+
+// ring is a fixed-size buffer of samples ordered by time
+type ring struct {
+	samples []Sample
+	start   int
+	size    int
+}
+
+func newRing(capacity int) *ring {
+	if capacity <= 0 {
+		capacity = DefaultHistorySize
+	}
+	return &ring{samples: make([]Sample, capacity)}
+}
+
+// add appends the sample overwriting the oldest one when the buffer is full
+func (r *ring) add(s Sample) {
+	capacity := len(r.samples)
+	if r.size < capacity {
+		r.samples[(r.start+r.size)%capacity] = s
+		r.size++
+		return
+	}
+	r.samples[r.start] = s
+	r.start = (r.start + 1) % capacity
+}
+
+// dropBefore removes samples older than the time
+func (r *ring) dropBefore(t time.Time) {
+	for r.size > 0 && r.samples[r.start].Time.Before(t) {
+		r.samples[r.start] = Sample{}
+		r.start = (r.start + 1) % len(r.samples)
+		r.size--
+	}
+}
+
+// between returns samples with from <= time <= to
+func (r *ring) between(from, to time.Time) []Sample {
+	res := []Sample{}
+	for i := 0; i < r.size; i++ {
+		s := r.samples[(r.start+i)%len(r.samples)]
+		if s.Time.Before(from) || s.Time.After(to) {
+			continue
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+// seriesKey returns the key of the series in the history map
+func seriesKey(mtype, name string) string {
+	return mtype + ":" + name
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRing_Overwrite(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := newRing(3)
+	for i := 0; i < 5; i++ {
+		r.add(Sample{Time: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+	res := r.between(start, start.Add(time.Minute))
+	assert.Equal(t, []Sample{
+		{Time: start.Add(2 * time.Second), Value: 2},
+		{Time: start.Add(3 * time.Second), Value: 3},
+		{Time: start.Add(4 * time.Second), Value: 4},
+	}, res)
+}
+
+func TestRing_Between(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := newRing(10)
+	for i := 0; i < 5; i++ {
+		r.add(Sample{Time: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+	res := r.between(start.Add(time.Second), start.Add(3*time.Second))
+	assert.Len(t, res, 3)
+	assert.Equal(t, 1.0, res[0].Value)
+	assert.Equal(t, 3.0, res[2].Value)
+}
+
+func TestRing_DropBefore(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := newRing(10)
+	for i := 0; i < 5; i++ {
+		r.add(Sample{Time: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+	r.dropBefore(start.Add(3 * time.Second))
+	assert.Equal(t, 2, r.size)
+	assert.Equal(t, 3.0, r.between(start, start.Add(time.Minute))[0].Value)
+}
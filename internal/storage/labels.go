@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// NameLabel is the matcher label that refers to the metric id
+const NameLabel = "__name__"
+
+// Label matcher types
+const (
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// ValidateID checks that the metric id has no label delimiters, otherwise its key could carry labels
+// that bypass ValidateLabels
+func ValidateID(id string) error {
+	if strings.ContainsAny(id, "{}") {
+		return fmt.Errorf("invalid metric id %q", id)
+	}
+	return nil
+}
+
+// ValidateLabels checks that all label names are valid
+func ValidateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRe.MatchString(name) || name == NameLabel {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// ParseLabels parses a comma separated list of name=value pairs
+func ParseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q", pair)
+		}
+		labels[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if err := ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// MetricKey returns the storage key of the series.
+// It is the id itself without labels and id{name="value",...} with labels sorted by name.
+func MetricKey(id string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return id
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(id)
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(labels[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseMetricKey splits the storage key into the id and labels.
+// A key that is not in the MetricKey format is returned as the id without labels.
+func ParseMetricKey(key string) (string, map[string]string) {
+	start := strings.IndexByte(key, '{')
+	if start < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+	labels := make(map[string]string)
+	rest := key[start+1 : len(key)-1]
+	for rest != "" {
+		name, value, ok := strings.Cut(rest, `="`)
+		if !ok || !labelNameRe.MatchString(name) {
+			return key, nil
+		}
+		var b strings.Builder
+		i := 0
+		for ; i < len(value) && value[i] != '"'; i++ {
+			if value[i] == '\\' && i+1 < len(value) {
+				i++
+				if value[i] == 'n' {
+					b.WriteByte('\n')
+					continue
+				}
+			}
+			b.WriteByte(value[i])
+		}
+		if i == len(value) {
+			return key, nil
+		}
+		labels[name] = b.String()
+		rest = value[i+1:]
+		if rest != "" {
+			if rest[0] != ',' {
+				return key, nil
+			}
+			rest = rest[1:]
+		}
+	}
+	return key[:start], labels
+}
+
+// Matcher selects series by the value of one label
+type Matcher struct {
+	Name  string
+	Type  string
+	Value string
+	re    *regexp.Regexp
+}
+
+// ParseMatcher parses a matcher like host=web1, env!=dev, host=~web.* or host!~db.*
+func ParseMatcher(s string) (Matcher, error) {
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return Matcher{}, fmt.Errorf("invalid matcher %q", s)
+	}
+	m := Matcher{Name: strings.TrimSpace(s[:i])}
+	switch rest := s[i:]; {
+	case strings.HasPrefix(rest, MatchNotEqual), strings.HasPrefix(rest, MatchRegexp), strings.HasPrefix(rest, MatchNotRegexp):
+		m.Type, m.Value = rest[:2], rest[2:]
+	case strings.HasPrefix(rest, MatchEqual):
+		m.Type, m.Value = MatchEqual, rest[1:]
+	default:
+		return Matcher{}, fmt.Errorf("invalid matcher %q", s)
+	}
+	if !labelNameRe.MatchString(m.Name) {
+		return Matcher{}, fmt.Errorf("invalid label name %q", m.Name)
+	}
+	m.Value = strings.Trim(strings.TrimSpace(m.Value), `"`)
+	if m.Type == MatchRegexp || m.Type == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return Matcher{}, err
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether the label value satisfies the matcher, a missing label has an empty value
+func (m Matcher) Matches(v string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// MatchSeries reports whether the series satisfies all matchers
+func MatchSeries(matchers []Matcher, id string, labels map[string]string) bool {
+	for _, m := range matchers {
+		v := labels[m.Name]
+		if m.Name == NameLabel {
+			v = id
+		}
+		if !m.Matches(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMetricKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		labels map[string]string
+		want   string
+	}{
+		{name: "without labels", id: "HeapAlloc", want: "HeapAlloc"},
+		{name: "sorted labels", id: "load", labels: map[string]string{"host": "web1", "env": "prod"}, want: `load{env="prod",host="web1"}`},
+		{name: "escaped value", id: "note", labels: map[string]string{"text": "a \"b\"\\\nc"}, want: `note{text="a \"b\"\\\nc"}`},
+		{name: "empty value", id: "load", labels: map[string]string{"host": ""}, want: `load{host=""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := MetricKey(tt.id, tt.labels)
+			assert.Equal(t, tt.want, key)
+			id, labels := ParseMetricKey(key)
+			assert.Equal(t, tt.id, id)
+			assert.Equal(t, len(tt.labels), len(labels))
+			for name, value := range tt.labels {
+				assert.Equal(t, value, labels[name])
+			}
+		})
+	}
+}
+
+func TestParseMetricKeyInvalid(t *testing.T) {
+	for _, key := range []string{"a{b}", `a{b="c}`, `a{b="c"d="e"}`, `a{1="c"}`} {
+		id, labels := ParseMetricKey(key)
+		assert.Equal(t, key, id)
+		assert.Nil(t, labels)
+	}
+}
+
+func TestValidateID(t *testing.T) {
+	assert.NoError(t, ValidateID("HeapAlloc"))
+	assert.Error(t, ValidateID(`load{host="web1"}`))
+	assert.Error(t, ValidateID("load}"))
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels(" host=web1, env = prod ,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"host": "web1", "env": "prod"}, labels)
+
+	labels, err = ParseLabels("")
+	assert.NoError(t, err)
+	assert.Empty(t, labels)
+
+	_, err = ParseLabels("host")
+	assert.Error(t, err)
+	_, err = ParseLabels("1host=web1")
+	assert.Error(t, err)
+	_, err = ParseLabels("__name__=web1")
+	assert.Error(t, err)
+}
+
+func TestMatcher(t *testing.T) {
+	labels := map[string]string{"host": "web1", "env": "prod"}
+	tests := []struct {
+		matcher string
+		want    bool
+	}{
+		{matcher: "host=web1", want: true},
+		{matcher: `host="web1"`, want: true},
+		{matcher: "host=web2", want: false},
+		{matcher: "env!=dev", want: true},
+		{matcher: "host=~web.*", want: true},
+		{matcher: "host=~web", want: false},
+		{matcher: "host!~db.*", want: true},
+		{matcher: "dc=", want: true},
+		{matcher: "__name__=load", want: true},
+		{matcher: "__name__!=load", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.matcher, func(t *testing.T) {
+			m, err := ParseMatcher(tt.matcher)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, MatchSeries([]Matcher{m}, "load", labels))
+		})
+	}
+
+	for _, s := range []string{"host", "=web1", "host!web1", "1host=web1", "host=~("} {
+		_, err := ParseMatcher(s)
+		assert.Error(t, err, s)
+	}
+}
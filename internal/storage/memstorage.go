@@ -2,71 +2,693 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
+// shardCount is the number of independently locked parts of MemStorage
+const shardCount = 32
+
+// Snapshot is the content of the storage, it is saved to the file and restored from it
+type Snapshot struct {
+	Gauge      map[string]float64   `json:"gauge"`
+	Counter    map[string]int64     `json:"counter"`
+	Histograms map[string]Histogram `json:"histograms,omitempty"`
+	Silences   map[string]Silence   `json:"silences,omitempty"`
+	// Reported holds the last cumulative values of the counters by source, see MStorage.UpdateFromSource
+	Reported map[string]map[string]int64 `json:"reported,omitempty"`
+	WALSeq   uint64                      `json:"wal_seq,omitempty"` // последний примененный батч WAL
+}
+
+// MemStorage keeps the metrics in memory. The series are spread over shards by the key hash
+// and every shard has its own lock, so series do not wait for each other.
+// The zero value is ready to use, MemStorage must not be copied after the first use.
 type MemStorage struct {
-	Gauge   map[string]float64 `json:"gauge"`
-	Counter map[string]int64   `json:"counter"`
+	WAL              *WAL
+	HistorySize      int
+	HistoryRetention time.Duration
+
+	shards     [shardCount]memShard
+	silencesMu sync.RWMutex
+	silences   map[string]Silence
+	// walMu is held for reading by the updates and for writing by Compact,
+	// so a snapshot never misses a batch that is already in the WAL
+	walMu  sync.RWMutex
+	walSeq uint64
+}
+
+// memShard holds the series whose keys hash to it
+type memShard struct {
+	mu         sync.RWMutex
+	gauge      map[string]float64
+	counter    map[string]int64
+	histograms map[string]Histogram
+	history    map[string]*ring
+	updated    map[string]time.Time // время последнего обновления по seriesKey, для TTL
+	reported   map[string]map[string]int64
 }
 
 //go:generate  mockgen -build_flags=--mod=mod -destination=mocks/mock_store.go -package=mocks . MStorage
 type MStorage interface {
-	CountStorage(context.Context, string, int64)
-	GaugeStorage(context.Context, string, float64)
-	GetStorage(context.Context) interface{}
-	GetCount(context.Context, string) (int64, bool)
-	GetGauge(context.Context, string) (float64, bool)
-	SetStartData(MemStorage)
+	CountStorage(context.Context, string, int64) error
+	GaugeStorage(context.Context, string, float64) error
+	GetStorage(context.Context) (Snapshot, error)
+	GetCount(context.Context, string) (int64, error)
+	GetGauge(context.Context, string) (float64, error)
+	HistogramStorage(context.Context, string, Histogram) error
+	GetHistogram(context.Context, string) (Histogram, error)
+	SetStartData(Snapshot)
 	UpdateBatch(context.Context, []Metrics) error
+	// UpdateFromSource saves the list like UpdateBatch, but the counters hold the cumulative values
+	// reported by the source. The storage adds their increase since the previous values of the source,
+	// the values are saved with the update and removed with the series.
+	UpdateFromSource(context.Context, string, []Metrics) error
+	AddSilence(context.Context, Silence) error
+	GetSilences(context.Context) ([]Silence, error)
+	DeleteSilence(context.Context, string) (bool, error)
+	GetRange(context.Context, string, string, time.Time, time.Time) ([]Sample, error)
+	DeleteMetrics(context.Context, []Metrics) (int, error)
+	Expire(context.Context, time.Time) (int, error)
+	Ping(context.Context) error
+}
+
+func (s *MemStorage) CountStorage(c context.Context, k string, v int64) error {
+	return s.write([]walRecord{{Key: k, MType: config.Counter, Delta: v}}, nil)
+}
+
+func (s *MemStorage) GaugeStorage(c context.Context, k string, v float64) error {
+	return s.write([]walRecord{{Key: k, MType: config.Gauge, Value: v}}, nil)
+}
+
+// Ping reports whether the storage is available, the memory storage always is
+func (s *MemStorage) Ping(c context.Context) error {
+	return nil
+}
+
+// HistogramStorage merges the observations into the stored histogram
+func (s *MemStorage) HistogramStorage(c context.Context, k string, h Histogram) error {
+	if err := h.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+	}
+	return s.write([]walRecord{{Key: k, MType: config.Histogram, Histogram: &h}}, nil)
+}
+
+// shard returns the shard that holds the series
+func (s *MemStorage) shard(key string) *memShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &s.shards[h.Sum32()%shardCount]
+}
+
+// lockShards locks the shards of the records in the order of their index, so batches do not deadlock
+func (s *MemStorage) lockShards(records []walRecord) []*memShard {
+	var used [shardCount]bool
+	for _, r := range records {
+		h := fnv.New32a()
+		h.Write([]byte(r.Key))
+		used[h.Sum32()%shardCount] = true
+	}
+	shards := make([]*memShard, 0, len(records))
+	for i := range used {
+		if used[i] {
+			s.shards[i].mu.Lock()
+			shards = append(shards, &s.shards[i])
+		}
+	}
+	return shards
+}
+
+// write logs the records to the WAL when it is set and applies them.
+// done is called before the shards are unlocked, it may read the series of the records.
+func (s *MemStorage) write(records []walRecord, done func()) error {
+	if s.WAL != nil {
+		s.walMu.RLock()
+		defer s.walMu.RUnlock()
+	}
+	shards := s.lockShards(records)
+	defer unlockShards(shards)
+
+	if err := s.commit(records); err != nil {
+		return err
+	}
+	if done != nil {
+		done()
+	}
+	return nil
+}
+
+// commit logs the records to the WAL when it is set and applies them,
+// the shards of the records and walMu must be locked
+func (s *MemStorage) commit(records []walRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if s.WAL != nil {
+		if _, err := s.WAL.append(records); err != nil {
+			return err
+		}
+	}
+	for _, r := range records {
+		s.apply(s.shard(r.Key), r)
+	}
+	return nil
+}
+
+func unlockShards(shards []*memShard) {
+	for _, sh := range shards {
+		sh.mu.Unlock()
+	}
+}
+
+// apply changes the series by the record, the shard must be locked
+func (s *MemStorage) apply(sh *memShard, r walRecord) {
+	if r.Op == walDelete {
+		sh.remove(r.MType, r.Key)
+		return
+	}
+	if sh.updated == nil {
+		sh.updated = make(map[string]time.Time)
+	}
+	sh.updated[seriesKey(r.MType, r.Key)] = time.Now()
+	switch r.MType {
+	case config.Gauge:
+		if sh.gauge == nil {
+			sh.gauge = make(map[string]float64)
+		}
+		sh.gauge[r.Key] = r.Value
+		s.record(sh, config.Gauge, r.Key, r.Value)
+	case config.Counter:
+		if sh.counter == nil {
+			sh.counter = make(map[string]int64)
+		}
+		sh.counter[r.Key] += r.Delta
+		s.record(sh, config.Counter, r.Key, float64(sh.counter[r.Key]))
+		if r.Source != "" {
+			sh.report(r.Key, r.Source, r.Reported)
+		}
+	case config.Histogram:
+		if sh.histograms == nil {
+			sh.histograms = make(map[string]Histogram)
+		}
+		sh.histograms[r.Key] = sh.histograms[r.Key].Merge(*r.Histogram)
+	}
 }
 
-func (s *MemStorage) CountStorage(c context.Context, k string, v int64) {
-	s.Counter[k] += v
+// Replay applies the WAL batches that are newer than the restored snapshot
+func (s *MemStorage) Replay() error {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	return s.WAL.replay(s.walSeq, func(batch walBatch) {
+		for _, r := range batch.Records {
+			if r.Op == walSilence || r.Op == walUnsilence {
+				s.silencesMu.Lock()
+				s.applySilence(r)
+				s.silencesMu.Unlock()
+				continue
+			}
+			sh := s.shard(r.Key)
+			sh.mu.Lock()
+			s.apply(sh, r)
+			sh.mu.Unlock()
+		}
+		s.walSeq = batch.Seq
+	})
 }
 
-func (s *MemStorage) GaugeStorage(c context.Context, k string, v float64) {
-	s.Gauge[k] = v
+// Compact passes a snapshot that contains every WAL batch to save and truncates the WAL after it is saved.
+// Updates wait until the compaction is finished.
+func (s *MemStorage) Compact(save func(Snapshot) error) error {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	if err := save(s.Snapshot()); err != nil {
+		return err
+	}
+	return s.WAL.truncate()
+}
+
+// TruncateWAL drops the WAL batches, it is called when the snapshot is not restored
+func (s *MemStorage) TruncateWAL() error {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	return s.WAL.truncate()
+}
+
+// record adds the value to the history of the series, the shard must be locked
+func (s *MemStorage) record(sh *memShard, mtype, name string, v float64) {
+	if sh.history == nil {
+		sh.history = make(map[string]*ring)
+	}
+	key := seriesKey(mtype, name)
+	r, exists := sh.history[key]
+	if !exists {
+		r = newRing(s.HistorySize)
+		sh.history[key] = r
+	}
+	now := time.Now()
+	if s.HistoryRetention > 0 {
+		r.dropBefore(now.Add(-s.HistoryRetention))
+	}
+	r.add(Sample{Time: now, Value: v})
+}
+
+func (s *MemStorage) GetRange(c context.Context, mtype string, name string, from time.Time, to time.Time) ([]Sample, error) {
+	sh := s.shard(name)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	r, exists := sh.history[seriesKey(mtype, name)]
+	if !exists {
+		return []Sample{}, nil
+	}
+	if s.HistoryRetention > 0 {
+		if oldest := time.Now().Add(-s.HistoryRetention); from.Before(oldest) {
+			from = oldest
+		}
+	}
+	return r.between(from, to), nil
 }
 
-func (s *MemStorage) GetStorage(c context.Context) interface{} {
-	return *s
+// NewMemStorage returns a memory storage that holds the data
+func NewMemStorage(data Snapshot) *MemStorage {
+	m := &MemStorage{}
+	m.SetStartData(data)
+	return m
 }
 
-func (s *MemStorage) SetStartData(storage MemStorage) {
-	s.Gauge = storage.Gauge
-	s.Counter = storage.Counter
+// Snapshot copies the content of the storage. All shards are locked at once in the order of their index,
+// like lockShards does, so the snapshot never holds a part of a batch.
+func (s *MemStorage) Snapshot() Snapshot {
+	for i := range s.shards {
+		s.shards[i].mu.RLock()
+	}
+	res := Snapshot{
+		Gauge:   make(map[string]float64),
+		Counter: make(map[string]int64),
+		WALSeq:  s.walSeq,
+	}
+	if s.WAL != nil {
+		res.WALSeq = s.WAL.lastSeq()
+	}
+	for i := range s.shards {
+		sh := &s.shards[i]
+		for k, v := range sh.gauge {
+			res.Gauge[k] = v
+		}
+		for k, v := range sh.counter {
+			res.Counter[k] = v
+		}
+		for k, h := range sh.histograms {
+			if res.Histograms == nil {
+				res.Histograms = make(map[string]Histogram)
+			}
+			res.Histograms[k] = h
+		}
+		for k, sources := range sh.reported {
+			if res.Reported == nil {
+				res.Reported = make(map[string]map[string]int64)
+			}
+			res.Reported[k] = make(map[string]int64, len(sources))
+			for source, v := range sources {
+				res.Reported[k][source] = v
+			}
+		}
+	}
+	for i := range s.shards {
+		s.shards[i].mu.RUnlock()
+	}
+	s.silencesMu.RLock()
+	for id, silence := range s.silences {
+		if res.Silences == nil {
+			res.Silences = make(map[string]Silence)
+		}
+		res.Silences[id] = silence
+	}
+	s.silencesMu.RUnlock()
+	return res
 }
 
-func (s *MemStorage) GetGauge(c context.Context, key string) (float64, bool) {
-	v, exists := s.Gauge[key]
-	return v, exists
+// GetStorage returns a Snapshot of all metrics and silences
+func (s *MemStorage) GetStorage(c context.Context) (Snapshot, error) {
+	return s.Snapshot(), nil
 }
 
-func (s *MemStorage) GetCount(c context.Context, key string) (int64, bool) {
-	v, exists := s.Counter[key]
-	return v, exists
+// MarshalJSON encodes the storage as its Snapshot
+func (s *MemStorage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Snapshot())
 }
 
+// SetStartData replaces the content of the storage with the restored snapshot
+func (s *MemStorage) SetStartData(storage Snapshot) {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		sh.gauge, sh.counter, sh.histograms, sh.updated, sh.reported = nil, nil, nil, nil, nil
+		sh.mu.Unlock()
+	}
+	// время обновления не сохраняется в снапшоте, TTL восстановленных серий считается с момента запуска
+	now := time.Now()
+	for k, v := range storage.Gauge {
+		sh := s.shard(k)
+		sh.mu.Lock()
+		if sh.gauge == nil {
+			sh.gauge = make(map[string]float64)
+		}
+		sh.touch(config.Gauge, k, now)
+		sh.gauge[k] = v
+		sh.mu.Unlock()
+	}
+	for k, v := range storage.Counter {
+		sh := s.shard(k)
+		sh.mu.Lock()
+		if sh.counter == nil {
+			sh.counter = make(map[string]int64)
+		}
+		sh.touch(config.Counter, k, now)
+		sh.counter[k] = v
+		sh.mu.Unlock()
+	}
+	for k, h := range storage.Histograms {
+		sh := s.shard(k)
+		sh.mu.Lock()
+		if sh.histograms == nil {
+			sh.histograms = make(map[string]Histogram)
+		}
+		sh.touch(config.Histogram, k, now)
+		sh.histograms[k] = h
+		sh.mu.Unlock()
+	}
+	for k, sources := range storage.Reported {
+		sh := s.shard(k)
+		sh.mu.Lock()
+		for source, v := range sources {
+			sh.report(k, source, v)
+		}
+		sh.mu.Unlock()
+	}
+	s.silencesMu.Lock()
+	s.silences = make(map[string]Silence, len(storage.Silences))
+	for id, silence := range storage.Silences {
+		s.silences[id] = silence
+	}
+	s.silencesMu.Unlock()
+	s.walSeq = storage.WALSeq
+}
+
+func (s *MemStorage) GetGauge(c context.Context, key string) (float64, error) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	v, exists := sh.gauge[key]
+	if !exists {
+		return 0, ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *MemStorage) GetCount(c context.Context, key string) (int64, error) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	v, exists := sh.counter[key]
+	if !exists {
+		return 0, ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *MemStorage) GetHistogram(c context.Context, key string) (Histogram, error) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	v, exists := sh.histograms[key]
+	if !exists {
+		return Histogram{}, ErrNotFound
+	}
+	return v, nil
+}
+
+// UpdateBatch applies all metrics or none of them when one is invalid.
+// Counters and histograms in the list are replaced with the totals after the update.
 func (s *MemStorage) UpdateBatch(c context.Context, list []Metrics) error {
+	records, err := batchRecords(list)
+	if err != nil {
+		return err
+	}
+	return s.write(records, func() {
+		s.setShardTotals(records, list)
+	})
+}
+
+// batchRecords validates the metrics and converts them to the records
+func batchRecords(list []Metrics) ([]walRecord, error) {
+	records := make([]walRecord, 0, len(list))
 	for _, metric := range list {
+		if err := metric.Validate(); err != nil {
+			return nil, err
+		}
+		r := walRecord{Key: metric.Key(), MType: metric.MType, Histogram: metric.Histogram}
 		switch metric.MType {
 		case config.Gauge:
-			k := metric.ID
-			v := metric.Value
-			s.GaugeStorage(c, k, *v)
+			r.Value = *metric.Value
+		case config.Counter:
+			r.Delta = *metric.Delta
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
 
+// setShardTotals replaces the counters and histograms of the list with the totals of their records,
+// the shards of the records must be locked
+func (s *MemStorage) setShardTotals(records []walRecord, list []Metrics) {
+	for i, r := range records {
+		switch r.MType {
 		case config.Counter:
-			k := metric.ID
-			v := metric.Delta
-			s.CountStorage(c, k, *v)
-			vNew, _ := s.GetCount(c, metric.ID)
-			metric.Delta = &vNew
-		default:
-			err := fmt.Errorf("unknowning metric type")
+			total := s.shard(r.Key).counter[r.Key]
+			list[i].Delta = &total
+		case config.Histogram:
+			total := s.shard(r.Key).histograms[r.Key]
+			list[i].Histogram = &total
+		}
+	}
+}
+
+// UpdateFromSource saves the list with the counters reported by the source as cumulative values.
+// The previous values of the source are read under the locks of the update, so the updates of the source
+// are counted once in any order. The reported values are logged to the WAL with the increase.
+func (s *MemStorage) UpdateFromSource(c context.Context, source string, list []Metrics) error {
+	records, err := batchRecords(list)
+	if err != nil {
+		return err
+	}
+	if s.WAL != nil {
+		s.walMu.RLock()
+		defer s.walMu.RUnlock()
+	}
+	shards := s.lockShards(records)
+	defer unlockShards(shards)
+
+	deltas, _ := toDeltas(source, list, func(key string) int64 {
+		return s.shard(key).reported[key][source]
+	})
+	for i := range records {
+		if records[i].MType == config.Counter {
+			records[i].Source = source
+			records[i].Reported = records[i].Delta
+			records[i].Delta = *deltas[i].Delta
+		}
+	}
+	if err := s.commit(records); err != nil {
+		return err
+	}
+	s.setShardTotals(records, list)
+	return nil
+}
+
+// AddSilence adds or replaces the silence, it is logged to the WAL like the series updates
+func (s *MemStorage) AddSilence(c context.Context, silence Silence) error {
+	if s.WAL != nil {
+		s.walMu.RLock()
+		defer s.walMu.RUnlock()
+	}
+	s.silencesMu.Lock()
+	defer s.silencesMu.Unlock()
+	return s.commitSilence(walRecord{Op: walSilence, Key: silence.ID, Silence: &silence})
+}
+
+// commitSilence logs the silence record to the WAL when it is set and applies it,
+// walMu and silencesMu must be locked
+func (s *MemStorage) commitSilence(r walRecord) error {
+	if s.WAL != nil {
+		if _, err := s.WAL.append([]walRecord{r}); err != nil {
 			return err
 		}
 	}
+	s.applySilence(r)
 	return nil
 }
+
+// applySilence adds or removes the silence by the record, silencesMu must be locked
+func (s *MemStorage) applySilence(r walRecord) {
+	if r.Op == walUnsilence {
+		delete(s.silences, r.Key)
+		return
+	}
+	if s.silences == nil {
+		s.silences = make(map[string]Silence)
+	}
+	s.silences[r.Key] = *r.Silence
+}
+
+func (s *MemStorage) GetSilences(c context.Context) ([]Silence, error) {
+	s.silencesMu.RLock()
+	defer s.silencesMu.RUnlock()
+	res := make([]Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		res = append(res, silence)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].StartsAt.Before(res[j].StartsAt)
+	})
+	return res, nil
+}
+
+// DeleteSilence removes the silence and reports whether it existed
+func (s *MemStorage) DeleteSilence(c context.Context, id string) (bool, error) {
+	if s.WAL != nil {
+		s.walMu.RLock()
+		defer s.walMu.RUnlock()
+	}
+	s.silencesMu.Lock()
+	defer s.silencesMu.Unlock()
+	if _, exists := s.silences[id]; !exists {
+		return false, nil
+	}
+	if err := s.commitSilence(walRecord{Op: walUnsilence, Key: id}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// touch sets the time of the last update of the series, the shard must be locked
+func (sh *memShard) touch(mtype, key string, t time.Time) {
+	if sh.updated == nil {
+		sh.updated = make(map[string]time.Time)
+	}
+	sh.updated[seriesKey(mtype, key)] = t
+}
+
+// exists reports whether the shard holds the series, the shard must be locked
+func (sh *memShard) exists(mtype, key string) bool {
+	var ok bool
+	switch mtype {
+	case config.Gauge:
+		_, ok = sh.gauge[key]
+	case config.Counter:
+		_, ok = sh.counter[key]
+	case config.Histogram:
+		_, ok = sh.histograms[key]
+	}
+	return ok
+}
+
+// report saves the last cumulative value of the counter reported by the source, the shard must be locked
+func (sh *memShard) report(key, source string, v int64) {
+	if sh.reported == nil {
+		sh.reported = make(map[string]map[string]int64)
+	}
+	if sh.reported[key] == nil {
+		sh.reported[key] = make(map[string]int64)
+	}
+	sh.reported[key][source] = v
+}
+
+// remove deletes the series with its history, the shard must be locked
+func (sh *memShard) remove(mtype, key string) {
+	switch mtype {
+	case config.Gauge:
+		delete(sh.gauge, key)
+	case config.Counter:
+		delete(sh.counter, key)
+		delete(sh.reported, key)
+	case config.Histogram:
+		delete(sh.histograms, key)
+	}
+	delete(sh.history, seriesKey(mtype, key))
+	delete(sh.updated, seriesKey(mtype, key))
+}
+
+// DeleteMetrics removes the series of the metrics and returns how many of them existed.
+// Only ID, MType and Labels of the metrics are used, nothing is removed when one of them is invalid.
+func (s *MemStorage) DeleteMetrics(c context.Context, list []Metrics) (int, error) {
+	records := make([]walRecord, 0, len(list))
+	for _, metric := range list {
+		if err := metric.ValidateSeries(); err != nil {
+			return 0, err
+		}
+		records = append(records, walRecord{Op: walDelete, Key: metric.Key(), MType: metric.MType})
+	}
+
+	if s.WAL != nil {
+		s.walMu.RLock()
+		defer s.walMu.RUnlock()
+	}
+	shards := s.lockShards(records)
+	defer unlockShards(shards)
+
+	existing := make([]walRecord, 0, len(records))
+	seen := make(map[string]bool)
+	for _, r := range records {
+		key := seriesKey(r.MType, r.Key)
+		if !seen[key] && s.shard(r.Key).exists(r.MType, r.Key) {
+			existing = append(existing, r)
+		}
+		seen[key] = true
+	}
+	if err := s.commit(existing); err != nil {
+		return 0, err
+	}
+	return len(existing), nil
+}
+
+// Expire removes the series that were not updated since the time and returns their number
+func (s *MemStorage) Expire(c context.Context, before time.Time) (int, error) {
+	var total int
+	for i := range s.shards {
+		n, err := s.expireShard(&s.shards[i], before)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// expireShard removes the stale series of one shard, the removal is logged to the WAL like DeleteMetrics
+func (s *MemStorage) expireShard(sh *memShard, before time.Time) (int, error) {
+	if s.WAL != nil {
+		s.walMu.RLock()
+		defer s.walMu.RUnlock()
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	var records []walRecord
+	for key, t := range sh.updated {
+		if t.Before(before) {
+			mtype, name, _ := strings.Cut(key, ":")
+			records = append(records, walRecord{Op: walDelete, Key: name, MType: mtype})
+		}
+	}
+	if err := s.commit(records); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
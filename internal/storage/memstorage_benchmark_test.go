@@ -2,14 +2,15 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
 func BenchmarkCountStorage(b *testing.B) {
-	memStorage := &MemStorage{
-		Counter: make(map[string]int64),
-	}
+	memStorage := &MemStorage{}
 	ctx := context.Background()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -18,9 +19,7 @@ func BenchmarkCountStorage(b *testing.B) {
 }
 
 func BenchmarkGaugeStorage(b *testing.B) {
-	memStorage := &MemStorage{
-		Gauge: make(map[string]float64),
-	}
+	memStorage := &MemStorage{}
 	ctx := context.Background()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -29,9 +28,8 @@ func BenchmarkGaugeStorage(b *testing.B) {
 }
 
 func BenchmarkGetGauge(b *testing.B) {
-	memStorage := &MemStorage{
-		Gauge: map[string]float64{"test": 1.0},
-	}
+	memStorage := &MemStorage{}
+	memStorage.SetStartData(Snapshot{Gauge: map[string]float64{"test": 1.0}})
 	ctx := context.Background()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -40,9 +38,8 @@ func BenchmarkGetGauge(b *testing.B) {
 }
 
 func BenchmarkGetCount(b *testing.B) {
-	memStorage := &MemStorage{
-		Counter: map[string]int64{"test": 1},
-	}
+	memStorage := &MemStorage{}
+	memStorage.SetStartData(Snapshot{Counter: map[string]int64{"test": 1}})
 	ctx := context.Background()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -51,10 +48,7 @@ func BenchmarkGetCount(b *testing.B) {
 }
 
 func BenchmarkUpdateBatch(b *testing.B) {
-	memStorage := &MemStorage{
-		Counter: make(map[string]int64),
-		Gauge:   make(map[string]float64),
-	}
+	memStorage := &MemStorage{}
 	v := 1.0
 	var d int64 = 1
 	metricsList := []Metrics{
@@ -67,3 +61,85 @@ func BenchmarkUpdateBatch(b *testing.B) {
 		memStorage.UpdateBatch(ctx, metricsList)
 	}
 }
+
+// benchKeys are the series updated by the parallel benchmarks, like the runtime metrics of an agent
+var benchKeys = func() []string {
+	keys := make([]string, 64)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("metric%d", i)
+	}
+	return keys
+}()
+
+// runParallel calls op with a different key on every iteration of every goroutine
+func runParallel(b *testing.B, op func(key string)) {
+	var next atomic.Uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := next.Add(1)
+		for pb.Next() {
+			op(benchKeys[i%uint64(len(benchKeys))])
+			i++
+		}
+	})
+}
+
+func BenchmarkCountStorageParallel(b *testing.B) {
+	memStorage := &MemStorage{HistorySize: 10}
+	ctx := context.Background()
+	runParallel(b, func(key string) {
+		memStorage.CountStorage(ctx, key, 1)
+	})
+}
+
+// BenchmarkCountStorageParallelGlobalLock serialises the updates with one mutex,
+// as the handlers did before MemStorage was sharded
+func BenchmarkCountStorageParallelGlobalLock(b *testing.B) {
+	memStorage := &MemStorage{HistorySize: 10}
+	var mu sync.Mutex
+	ctx := context.Background()
+	runParallel(b, func(key string) {
+		mu.Lock()
+		memStorage.CountStorage(ctx, key, 1)
+		mu.Unlock()
+	})
+}
+
+func BenchmarkGetGaugeParallel(b *testing.B) {
+	memStorage := &MemStorage{}
+	ctx := context.Background()
+	for _, key := range benchKeys {
+		memStorage.GaugeStorage(ctx, key, 1.0)
+	}
+	runParallel(b, func(key string) {
+		memStorage.GetGauge(ctx, key)
+	})
+}
+
+func BenchmarkMixedParallel(b *testing.B) {
+	memStorage := &MemStorage{HistorySize: 10}
+	ctx := context.Background()
+	runParallel(b, func(key string) {
+		memStorage.GaugeStorage(ctx, key, 1.0)
+		memStorage.GetGauge(ctx, key)
+		memStorage.GetGauge(ctx, key)
+		memStorage.GetGauge(ctx, key)
+	})
+}
+
+// BenchmarkMixedParallelGlobalLock is BenchmarkMixedParallel with the reads and writes behind one mutex
+func BenchmarkMixedParallelGlobalLock(b *testing.B) {
+	memStorage := &MemStorage{HistorySize: 10}
+	var mu sync.Mutex
+	ctx := context.Background()
+	runParallel(b, func(key string) {
+		mu.Lock()
+		memStorage.GaugeStorage(ctx, key, 1.0)
+		mu.Unlock()
+		for i := 0; i < 3; i++ {
+			mu.Lock()
+			memStorage.GetGauge(ctx, key)
+			mu.Unlock()
+		}
+	})
+}
@@ -2,50 +2,61 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCountStorage(t *testing.T) {
-	storage := &MemStorage{
-		Counter: make(map[string]int64),
-	}
+	storage := &MemStorage{}
 	storage.CountStorage(context.Background(), "test_key", 5)
-	assert.Equal(t, int64(5), storage.Counter["test_key"], "Expected value to be 5")
+	v, err := storage.GetCount(context.Background(), "test_key")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), v, "Expected value to be 5")
 }
 
 func TestMemStorage_GaugeStorage(t *testing.T) {
-	storage := &MemStorage{
-		Gauge: make(map[string]float64),
-	}
+	storage := &MemStorage{}
 	v := 5.5
 	storage.GaugeStorage(context.Background(), "test_key", v)
-	assert.Equal(t, v, storage.Gauge["test_key"], "Expected value to be 5")
+	res, err := storage.GetGauge(context.Background(), "test_key")
+	assert.NoError(t, err)
+	assert.Equal(t, v, res, "Expected value to be 5")
 }
 
 func TestGetGauge(t *testing.T) {
-	storage := &MemStorage{
+	storage := &MemStorage{}
+	storage.SetStartData(Snapshot{
 		Gauge: map[string]float64{
 			"test_key": 10.5,
 		},
-	}
-	value, exists := storage.GetGauge(context.Background(), "test_key")
-	assert.True(t, exists, "Expected key to exist")
+	})
+	value, err := storage.GetGauge(context.Background(), "test_key")
+	assert.NoError(t, err, "Expected key to exist")
 	assert.Equal(t, 10.5, value, "Expected value to be 10.5")
+
+	_, err = storage.GetGauge(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 func TestGetCount(t *testing.T) {
-	storage := &MemStorage{
+	storage := &MemStorage{}
+	storage.SetStartData(Snapshot{
 		Counter: map[string]int64{
 			"test_key": 10,
 		},
-	}
-	value, exists := storage.GetCount(context.Background(), "test_key")
-	assert.True(t, exists, "Expected key to exist")
+	})
+	value, err := storage.GetCount(context.Background(), "test_key")
+	assert.NoError(t, err, "Expected key to exist")
 	assert.Equal(t, int64(10), value, "Expected value to be 10.5")
+
+	_, err = storage.GetCount(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestGetStorage(t *testing.T) {
-	storage := &MemStorage{
+	data := Snapshot{
 		Gauge: map[string]float64{
 			"test_key": 10.5,
 		},
@@ -53,18 +64,16 @@ func TestGetStorage(t *testing.T) {
 			"test_counter": 20,
 		},
 	}
-	result := storage.GetStorage(context.Background())
-	memStorage, ok := result.(MemStorage)
-	assert.True(t, ok, "Expected result to be of type MemStorage")
-	assert.Equal(t, storage.Gauge, memStorage.Gauge, "Expected Gauge maps to be equal")
-	assert.Equal(t, storage.Counter, memStorage.Counter, "Expected Counter maps to be equal")
+	storage := &MemStorage{}
+	storage.SetStartData(data)
+	result, err := storage.GetStorage(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, data.Gauge, result.Gauge, "Expected Gauge maps to be equal")
+	assert.Equal(t, data.Counter, result.Counter, "Expected Counter maps to be equal")
 }
 
 func TestUpdateBatch(t *testing.T) {
-	storage := &MemStorage{
-		Gauge:   make(map[string]float64),
-		Counter: make(map[string]int64),
-	}
+	storage := &MemStorage{}
 
 	var v = 10.5
 	var d int64 = 5
@@ -77,11 +86,222 @@ func TestUpdateBatch(t *testing.T) {
 	err := storage.UpdateBatch(context.Background(), testMetrics)
 	assert.NoError(t, err, "Expected no error")
 
-	gaugeValue, exists := storage.Gauge["metric1"]
-	assert.True(t, exists, "Expected gauge metric1 to exist")
+	gaugeValue, err := storage.GetGauge(context.Background(), "metric1")
+	assert.NoError(t, err, "Expected gauge metric1 to exist")
 	assert.Equal(t, 10.5, gaugeValue, "Expected gauge metric1 value to be 10.5")
 
-	counterValue, exists := storage.Counter["metric2"]
-	assert.True(t, exists, "Expected counter metric2 to exist")
+	counterValue, err := storage.GetCount(context.Background(), "metric2")
+	assert.NoError(t, err, "Expected counter metric2 to exist")
 	assert.Equal(t, int64(5), counterValue, "Expected counter metric2 value to be 5")
 }
+
+func TestMemStorage_Silences(t *testing.T) {
+	storage := &MemStorage{}
+	now := time.Now()
+	ctx := context.Background()
+
+	err := storage.AddSilence(ctx, Silence{ID: "2", Matcher: "Heap*", StartsAt: now, EndsAt: now.Add(time.Hour)})
+	assert.NoError(t, err)
+	err = storage.AddSilence(ctx, Silence{ID: "1", Matcher: "PollCount", StartsAt: now.Add(-time.Hour), EndsAt: now})
+	assert.NoError(t, err)
+
+	silences, err := storage.GetSilences(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, silences, 2)
+	assert.Equal(t, "1", silences[0].ID, "Expected silences to be sorted by start")
+
+	deleted, err := storage.DeleteSilence(ctx, "1")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = storage.DeleteSilence(ctx, "1")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestMemStorage_GetRange(t *testing.T) {
+	storage := &MemStorage{
+		HistorySize: 2,
+	}
+	ctx := context.Background()
+	from := time.Now()
+	storage.GaugeStorage(ctx, "HeapAlloc", 1)
+	storage.GaugeStorage(ctx, "HeapAlloc", 2)
+	storage.GaugeStorage(ctx, "HeapAlloc", 3)
+	storage.CountStorage(ctx, "PollCount", 2)
+	storage.CountStorage(ctx, "PollCount", 3)
+	to := time.Now()
+
+	samples, err := storage.GetRange(ctx, "gauge", "HeapAlloc", from, to)
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2, "Expected ring buffer to keep only 2 samples")
+	assert.Equal(t, 2.0, samples[0].Value)
+	assert.Equal(t, 3.0, samples[1].Value)
+
+	samples, err = storage.GetRange(ctx, "counter", "PollCount", from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, 5.0, samples[1].Value, "Expected counter samples to hold the total")
+
+	samples, err = storage.GetRange(ctx, "gauge", "unknown", from, to)
+	assert.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestUpdateBatchWithLabels(t *testing.T) {
+	storage := &MemStorage{}
+	var v = 10.5
+	var d int64 = 5
+	labels := map[string]string{"host": "web1"}
+
+	err := storage.UpdateBatch(context.Background(), []Metrics{
+		{ID: "metric1", MType: "gauge", Value: &v, Labels: labels},
+		{ID: "metric2", MType: "counter", Delta: &d, Labels: labels},
+		{ID: "metric2", MType: "counter", Delta: &d},
+	})
+	assert.NoError(t, err)
+	snapshot := storage.Snapshot()
+	assert.Equal(t, map[string]float64{`metric1{host="web1"}`: 10.5}, snapshot.Gauge)
+	assert.Equal(t, map[string]int64{`metric2{host="web1"}`: 5, "metric2": 5}, snapshot.Counter)
+
+	err = storage.UpdateBatch(context.Background(), []Metrics{
+		{ID: "metric1", MType: "gauge", Value: &v, Labels: map[string]string{"host-name": "web1"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestMemStorage_HistogramStorage(t *testing.T) {
+	storage := &MemStorage{}
+	h := NewHistogram([]float64{1, 5})
+	h.Observe(0.5)
+	h.Observe(3)
+
+	err := storage.UpdateBatch(context.Background(), []Metrics{
+		{ID: "latency", MType: "histogram", Histogram: &h},
+		{ID: "latency", MType: "histogram", Histogram: &h},
+	})
+	assert.NoError(t, err)
+	res, err := storage.GetHistogram(context.Background(), "latency")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{2, 2, 0}, res.Counts)
+	assert.Equal(t, uint64(4), res.Count)
+
+	err = storage.UpdateBatch(context.Background(), []Metrics{{ID: "latency", MType: "histogram"}})
+	assert.Error(t, err)
+	err = storage.HistogramStorage(context.Background(), "latency", Histogram{Buckets: []float64{1}, Counts: []uint64{1}})
+	assert.Error(t, err)
+}
+
+func TestUpdateBatchTotals(t *testing.T) {
+	storage := &MemStorage{}
+	storage.SetStartData(Snapshot{Counter: map[string]int64{"PollCount": 10}})
+	var v = 1.5
+	var d int64 = 5
+	list := []Metrics{
+		{ID: "PollCount", MType: "counter", Delta: &d},
+		{ID: "HeapAlloc", MType: "gauge", Value: &v},
+		{ID: "PollCount", MType: "counter", Delta: &d},
+	}
+	assert.NoError(t, storage.UpdateBatch(context.Background(), list))
+	assert.Equal(t, int64(20), *list[0].Delta)
+	assert.Equal(t, int64(20), *list[2].Delta)
+	assert.Equal(t, int64(5), d, "Expected the request values to stay unchanged")
+
+	err := storage.UpdateBatch(context.Background(), []Metrics{
+		{ID: "PollCount", MType: "counter", Delta: &d},
+		{ID: "HeapAlloc", MType: "gauge"},
+	})
+	assert.ErrorIs(t, err, ErrInvalidMetric)
+	total, err := storage.GetCount(context.Background(), "PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), total, "Expected an invalid batch not to be applied")
+}
+
+func TestMemStorage_Concurrent(t *testing.T) {
+	storage := &MemStorage{HistorySize: 10}
+	ctx := context.Background()
+	var d int64 = 1
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("metric%d", j%10)
+				assert.NoError(t, storage.CountStorage(ctx, "PollCount", 1))
+				assert.NoError(t, storage.GaugeStorage(ctx, key, float64(i)))
+				assert.NoError(t, storage.UpdateBatch(ctx, []Metrics{{ID: key, MType: "counter", Delta: &d}}))
+				storage.GetGauge(ctx, key)
+				storage.GetStorage(ctx)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	total, err := storage.GetCount(ctx, "PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(800), total)
+	snapshot := storage.Snapshot()
+	for j := 0; j < 10; j++ {
+		assert.Equal(t, int64(80), snapshot.Counter[fmt.Sprintf("metric%d", j)])
+	}
+}
+
+func TestMemStorage_DeleteMetrics(t *testing.T) {
+	storage := &MemStorage{HistorySize: 10}
+	ctx := context.Background()
+	labels := map[string]string{"host": "web1"}
+	from := time.Now()
+	storage.GaugeStorage(ctx, "HeapAlloc", 1)
+	storage.GaugeStorage(ctx, MetricKey("HeapAlloc", labels), 2)
+	storage.CountStorage(ctx, "PollCount", 3)
+	storage.HistogramStorage(ctx, "latency", NewHistogram([]float64{1}))
+
+	deleted, err := storage.DeleteMetrics(ctx, []Metrics{
+		{ID: "HeapAlloc", MType: "gauge", Labels: labels},
+		{ID: "PollCount", MType: "counter"},
+		{ID: "PollCount", MType: "counter"},
+		{ID: "latency", MType: "histogram"},
+		{ID: "unknown", MType: "gauge"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	snapshot := storage.Snapshot()
+	assert.Equal(t, map[string]float64{"HeapAlloc": 1}, snapshot.Gauge)
+	assert.Empty(t, snapshot.Counter)
+	assert.Empty(t, snapshot.Histograms)
+	samples, err := storage.GetRange(ctx, "counter", "PollCount", from, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, samples, "Expected history of the deleted series to be dropped")
+
+	_, err = storage.DeleteMetrics(ctx, []Metrics{
+		{ID: "HeapAlloc", MType: "gauge"},
+		{ID: "HeapAlloc", MType: "unknown"},
+	})
+	assert.ErrorIs(t, err, ErrInvalidMetric)
+	_, err = storage.GetGauge(ctx, "HeapAlloc")
+	assert.NoError(t, err, "Expected invalid batch to delete nothing")
+}
+
+func TestMemStorage_Expire(t *testing.T) {
+	storage := &MemStorage{}
+	ctx := context.Background()
+	storage.GaugeStorage(ctx, "HeapAlloc", 1)
+	storage.CountStorage(ctx, "PollCount", 3)
+	before := time.Now()
+	storage.CountStorage(ctx, "PollCount", 2)
+
+	deleted, err := storage.Expire(ctx, before)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	snapshot := storage.Snapshot()
+	assert.Empty(t, snapshot.Gauge)
+	assert.Equal(t, map[string]int64{"PollCount": 5}, snapshot.Counter)
+
+	restored := &MemStorage{}
+	restored.SetStartData(snapshot)
+	deleted, err = restored.Expire(ctx, before)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted, "Expected restored series to count the TTL from the restore")
+	deleted, err = restored.Expire(ctx, time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+}
@@ -1,8 +1,70 @@
 package storage
 
+import (
+	"fmt"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+)
+
 type Metrics struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID        string     `json:"id"`                  // имя метрики
+	MType     string     `json:"type"`                // параметр, принимающий значение gauge, counter или histogram
+	Delta     *int64     `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+	Value     *float64   `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+	Histogram *Histogram `json:"histogram,omitempty"` // наблюдения с прошлой отправки в случае передачи histogram
+	Rate      *float64   `json:"rate,omitempty"`      // прирост counter в секунду, заполняется сервером в ответе /value/
+
+	Labels map[string]string `json:"labels,omitempty"` // метки серии, например host или env
+}
+
+// Key returns the storage key of the metric series
+func (m Metrics) Key() string {
+	return MetricKey(m.ID, m.Labels)
+}
+
+// Validate checks that the metric has a known type with its value and valid labels
+func (m Metrics) Validate() error {
+	if err := ValidateID(m.ID); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+	}
+	if err := ValidateLabels(m.Labels); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+	}
+	switch m.MType {
+	case config.Gauge:
+		if m.Value == nil {
+			return fmt.Errorf("%w: empty gauge value", ErrInvalidMetric)
+		}
+	case config.Counter:
+		if m.Delta == nil {
+			return fmt.Errorf("%w: empty counter delta", ErrInvalidMetric)
+		}
+	case config.Histogram:
+		if m.Histogram == nil {
+			return fmt.Errorf("%w: empty histogram", ErrInvalidMetric)
+		}
+		if err := m.Histogram.Validate(); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+		}
+	default:
+		return fmt.Errorf("%w: unknowning metric type", ErrInvalidMetric)
+	}
+	return nil
+}
+
+// ValidateSeries checks that the metric names a series of a known type, the value is not needed
+func (m Metrics) ValidateSeries() error {
+	if m.ID == "" {
+		return fmt.Errorf("%w: empty metric id", ErrInvalidMetric)
+	}
+	if err := ValidateID(m.ID); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+	}
+	if err := ValidateLabels(m.Labels); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+	}
+	switch m.MType {
+	case config.Gauge, config.Counter, config.Histogram:
+		return nil
+	}
+	return fmt.Errorf("%w: unknowning metric type", ErrInvalidMetric)
 }
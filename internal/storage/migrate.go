@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// LatestVersion is the Migrate target that applies all migrations
+const LatestVersion = -1
+
+// migrationLockID is the advisory lock that serialises migrations of several instances
+const migrationLockID = 7263541
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationNameRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations returns the embedded migrations sorted by version
+func Migrations() ([]Migration, error) {
+	files, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		match := migrationNameRe.FindStringSubmatch(file.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", file.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(migrationFiles, "migrations/"+file.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Version < res[j].Version
+	})
+	for i, m := range res {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("missing migration %d", i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both up and down files", m.Version)
+		}
+	}
+	return res, nil
+}
+
+// createSchemaVersion creates the table of applied migrations
+const createSchemaVersion = `CREATE TABLE IF NOT EXISTS schema_version (
+                         version INT PRIMARY KEY,
+                         name VARCHAR(255) NOT NULL,
+                         applied_at TIMESTAMPTZ NOT NULL DEFAULT now())`
+
+// SchemaVersion returns the version of the last applied migration, 0 for an empty database
+func SchemaVersion(c context.Context, db *sql.DB) (int, error) {
+	var exists bool
+	if err := db.QueryRowContext(c, "SELECT to_regclass('schema_version') IS NOT NULL").Scan(&exists); err != nil || !exists {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRowContext(c, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// Migrate applies up or down migrations until the schema reaches the target version.
+// Every migration runs in its own transaction under an advisory lock, so instances
+// starting at the same time apply each migration once.
+func Migrate(c context.Context, db *sql.DB, target int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if target == LatestVersion {
+		target = len(migrations)
+	}
+	if target < 0 || target > len(migrations) {
+		return fmt.Errorf("unknown schema version %d", target)
+	}
+	for {
+		done, err := migrateStep(c, db, migrations, target)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// migrateStep applies one migration towards the target, done is true when the target is reached
+func migrateStep(c context.Context, db *sql.DB, migrations []Migration, target int) (bool, error) {
+	tx, err := db.BeginTx(c, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(c, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(c, createSchemaVersion); err != nil {
+		return false, err
+	}
+	var current int
+	if err = tx.QueryRowContext(c, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		return false, err
+	}
+	switch {
+	case current == target:
+		return true, nil
+	case current < target:
+		m := migrations[current]
+		if _, err = tx.ExecContext(c, m.Up); err != nil {
+			return false, fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+		}
+		if _, err = tx.ExecContext(c, "INSERT INTO schema_version (version, name) VALUES ($1, $2)", m.Version, m.Name); err != nil {
+			return false, err
+		}
+	default:
+		if current > len(migrations) {
+			return false, fmt.Errorf("schema version %d is newer than the known migrations", current)
+		}
+		m := migrations[current-1]
+		if _, err = tx.ExecContext(c, m.Down); err != nil {
+			return false, fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+		}
+		if _, err = tx.ExecContext(c, "DELETE FROM schema_version WHERE version = $1", m.Version); err != nil {
+			return false, err
+		}
+	}
+	return false, tx.Commit()
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+	assert.Equal(t, "init", migrations[0].Name)
+}
+
+func TestDBStorage_Migrate(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+
+	version, err := SchemaVersion(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+
+	assert.NoError(t, Migrate(ctx, db, 1))
+	version, err = SchemaVersion(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	assert.NoError(t, Migrate(ctx, db, LatestVersion))
+	version, err = SchemaVersion(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+
+	assert.Error(t, Migrate(ctx, db, len(migrations)+1))
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS samples;
+DROP TABLE IF EXISTS silences;
+DROP TABLE IF EXISTS histogram;
+DROP TABLE IF EXISTS counter;
+DROP TABLE IF EXISTS gauge;
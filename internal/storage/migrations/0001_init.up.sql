@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS gauge (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}');
+CREATE TABLE IF NOT EXISTS counter (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    delta BIGINT NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}');
+CREATE TABLE IF NOT EXISTS histogram (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    buckets JSONB NOT NULL,
+    counts JSONB NOT NULL,
+    sum DOUBLE PRECISION NOT NULL,
+    count BIGINT NOT NULL);
+CREATE TABLE IF NOT EXISTS silences (
+    id VARCHAR(64) PRIMARY KEY,
+    matcher VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '');
+CREATE TABLE IF NOT EXISTS samples (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(16) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    ts TIMESTAMPTZ NOT NULL DEFAULT now());
+-- базы, созданные до появления меток
+ALTER TABLE gauge ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE counter ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE samples ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS samples_series_ts ON samples (type, name, ts);
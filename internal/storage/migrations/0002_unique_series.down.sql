@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS samples_series_ts;
+CREATE INDEX IF NOT EXISTS samples_series_ts ON samples (type, name, ts);
+DROP INDEX IF EXISTS histogram_series;
+DROP INDEX IF EXISTS counter_series;
+DROP INDEX IF EXISTS gauge_series;
@@ -0,0 +1,14 @@
+-- Дубликаты появлялись при гонке SELECT COUNT(*) + INSERT. UPDATE менял все строки серии,
+-- поэтому у дублей одинаковые приращения: оставляем строку с наибольшим значением счётчика
+-- и самую новую строку gauge и histogram.
+DELETE FROM counter c USING counter o
+    WHERE c.name = o.name AND c.labels = o.labels AND (c.delta < o.delta OR (c.delta = o.delta AND c.id < o.id));
+DELETE FROM gauge g USING gauge o
+    WHERE g.name = o.name AND g.labels = o.labels AND g.id < o.id;
+DELETE FROM histogram h USING histogram o
+    WHERE h.name = o.name AND h.labels = o.labels AND h.id < o.id;
+CREATE UNIQUE INDEX IF NOT EXISTS gauge_series ON gauge (name, labels);
+CREATE UNIQUE INDEX IF NOT EXISTS counter_series ON counter (name, labels);
+CREATE UNIQUE INDEX IF NOT EXISTS histogram_series ON histogram (name, labels);
+DROP INDEX IF EXISTS samples_series_ts;
+CREATE INDEX IF NOT EXISTS samples_series_ts ON samples (type, name, labels, ts);
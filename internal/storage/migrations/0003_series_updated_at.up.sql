@@ -0,0 +1,4 @@
+-- время последнего обновления серии для удаления по TTL, существующие серии считаются обновленными сейчас
+ALTER TABLE gauge ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE counter ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE histogram ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,8 @@
+-- последние накопленные значения счетчиков по источникам, приращение считается от них
+CREATE TABLE IF NOT EXISTS counter_sources (
+    name VARCHAR(255) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    source VARCHAR(255) NOT NULL,
+    value BIGINT NOT NULL,
+    PRIMARY KEY (name, labels, source)
+);
@@ -0,0 +1,282 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/Nchezhegova/metrics-alerts/internal/storage (interfaces: MStorage)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	storage "github.com/Nchezhegova/metrics-alerts/internal/storage"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockMStorage is a mock of MStorage interface.
+type MockMStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockMStorageMockRecorder
+}
+
+// MockMStorageMockRecorder is the mock recorder for MockMStorage.
+type MockMStorageMockRecorder struct {
+	mock *MockMStorage
+}
+
+// NewMockMStorage creates a new mock instance.
+func NewMockMStorage(ctrl *gomock.Controller) *MockMStorage {
+	mock := &MockMStorage{ctrl: ctrl}
+	mock.recorder = &MockMStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMStorage) EXPECT() *MockMStorageMockRecorder {
+	return m.recorder
+}
+
+// AddSilence mocks base method.
+func (m *MockMStorage) AddSilence(arg0 context.Context, arg1 storage.Silence) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddSilence", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddSilence indicates an expected call of AddSilence.
+func (mr *MockMStorageMockRecorder) AddSilence(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddSilence", reflect.TypeOf((*MockMStorage)(nil).AddSilence), arg0, arg1)
+}
+
+// CountStorage mocks base method.
+func (m *MockMStorage) CountStorage(arg0 context.Context, arg1 string, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountStorage", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CountStorage indicates an expected call of CountStorage.
+func (mr *MockMStorageMockRecorder) CountStorage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountStorage", reflect.TypeOf((*MockMStorage)(nil).CountStorage), arg0, arg1, arg2)
+}
+
+// DeleteMetrics mocks base method.
+func (m *MockMStorage) DeleteMetrics(arg0 context.Context, arg1 []storage.Metrics) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetrics", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMetrics indicates an expected call of DeleteMetrics.
+func (mr *MockMStorageMockRecorder) DeleteMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetrics", reflect.TypeOf((*MockMStorage)(nil).DeleteMetrics), arg0, arg1)
+}
+
+// DeleteSilence mocks base method.
+func (m *MockMStorage) DeleteSilence(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteSilence", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteSilence indicates an expected call of DeleteSilence.
+func (mr *MockMStorageMockRecorder) DeleteSilence(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSilence", reflect.TypeOf((*MockMStorage)(nil).DeleteSilence), arg0, arg1)
+}
+
+// Expire mocks base method.
+func (m *MockMStorage) Expire(arg0 context.Context, arg1 time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Expire", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Expire indicates an expected call of Expire.
+func (mr *MockMStorageMockRecorder) Expire(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expire", reflect.TypeOf((*MockMStorage)(nil).Expire), arg0, arg1)
+}
+
+// GaugeStorage mocks base method.
+func (m *MockMStorage) GaugeStorage(arg0 context.Context, arg1 string, arg2 float64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GaugeStorage", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GaugeStorage indicates an expected call of GaugeStorage.
+func (mr *MockMStorageMockRecorder) GaugeStorage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GaugeStorage", reflect.TypeOf((*MockMStorage)(nil).GaugeStorage), arg0, arg1, arg2)
+}
+
+// GetCount mocks base method.
+func (m *MockMStorage) GetCount(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCount", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCount indicates an expected call of GetCount.
+func (mr *MockMStorageMockRecorder) GetCount(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCount", reflect.TypeOf((*MockMStorage)(nil).GetCount), arg0, arg1)
+}
+
+// GetGauge mocks base method.
+func (m *MockMStorage) GetGauge(arg0 context.Context, arg1 string) (float64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGauge", arg0, arg1)
+	ret0, _ := ret[0].(float64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGauge indicates an expected call of GetGauge.
+func (mr *MockMStorageMockRecorder) GetGauge(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGauge", reflect.TypeOf((*MockMStorage)(nil).GetGauge), arg0, arg1)
+}
+
+// GetHistogram mocks base method.
+func (m *MockMStorage) GetHistogram(arg0 context.Context, arg1 string) (storage.Histogram, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogram", arg0, arg1)
+	ret0, _ := ret[0].(storage.Histogram)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistogram indicates an expected call of GetHistogram.
+func (mr *MockMStorageMockRecorder) GetHistogram(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogram", reflect.TypeOf((*MockMStorage)(nil).GetHistogram), arg0, arg1)
+}
+
+// GetRange mocks base method.
+func (m *MockMStorage) GetRange(arg0 context.Context, arg1, arg2 string, arg3, arg4 time.Time) ([]storage.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRange", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]storage.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRange indicates an expected call of GetRange.
+func (mr *MockMStorageMockRecorder) GetRange(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRange", reflect.TypeOf((*MockMStorage)(nil).GetRange), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetSilences mocks base method.
+func (m *MockMStorage) GetSilences(arg0 context.Context) ([]storage.Silence, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSilences", arg0)
+	ret0, _ := ret[0].([]storage.Silence)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSilences indicates an expected call of GetSilences.
+func (mr *MockMStorageMockRecorder) GetSilences(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSilences", reflect.TypeOf((*MockMStorage)(nil).GetSilences), arg0)
+}
+
+// GetStorage mocks base method.
+func (m *MockMStorage) GetStorage(arg0 context.Context) (storage.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStorage", arg0)
+	ret0, _ := ret[0].(storage.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStorage indicates an expected call of GetStorage.
+func (mr *MockMStorageMockRecorder) GetStorage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStorage", reflect.TypeOf((*MockMStorage)(nil).GetStorage), arg0)
+}
+
+// HistogramStorage mocks base method.
+func (m *MockMStorage) HistogramStorage(arg0 context.Context, arg1 string, arg2 storage.Histogram) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HistogramStorage", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HistogramStorage indicates an expected call of HistogramStorage.
+func (mr *MockMStorageMockRecorder) HistogramStorage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HistogramStorage", reflect.TypeOf((*MockMStorage)(nil).HistogramStorage), arg0, arg1, arg2)
+}
+
+// Ping mocks base method.
+func (m *MockMStorage) Ping(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockMStorageMockRecorder) Ping(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockMStorage)(nil).Ping), arg0)
+}
+
+// SetStartData mocks base method.
+func (m *MockMStorage) SetStartData(arg0 storage.Snapshot) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetStartData", arg0)
+}
+
+// SetStartData indicates an expected call of SetStartData.
+func (mr *MockMStorageMockRecorder) SetStartData(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetStartData", reflect.TypeOf((*MockMStorage)(nil).SetStartData), arg0)
+}
+
+// UpdateBatch mocks base method.
+func (m *MockMStorage) UpdateBatch(arg0 context.Context, arg1 []storage.Metrics) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBatch", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateBatch indicates an expected call of UpdateBatch.
+func (mr *MockMStorageMockRecorder) UpdateBatch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBatch", reflect.TypeOf((*MockMStorage)(nil).UpdateBatch), arg0, arg1)
+}
+
+// UpdateFromSource mocks base method.
+func (m *MockMStorage) UpdateFromSource(arg0 context.Context, arg1 string, arg2 []storage.Metrics) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateFromSource", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateFromSource indicates an expected call of UpdateFromSource.
+func (mr *MockMStorageMockRecorder) UpdateFromSource(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateFromSource", reflect.TypeOf((*MockMStorage)(nil).UpdateFromSource), arg0, arg1, arg2)
+}
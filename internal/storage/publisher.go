@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+)
+
+// Publisher is the storage that sends the series updated by GaugeStorage, CountStorage,
+// HistogramStorage, UpdateBatch and UpdateFromSource to the stream.
+// Counters and histograms are published with the value after the update, they are read back from the storage
+// only when the stream has subscribers. The values of concurrent updates of a series may be published out of order.
+type Publisher struct {
+	MStorage
+	stream *Stream
+}
+
+// NewPublisher wraps the storage
+func NewPublisher(m MStorage, stream *Stream) *Publisher {
+	return &Publisher{MStorage: m, stream: stream}
+}
+
+// Unwrap returns the wrapped storage
+func (p *Publisher) Unwrap() MStorage {
+	return p.MStorage
+}
+
+// Unwrap returns the storage under the wrappers like Publisher, e.g. to check its type
+func Unwrap(m MStorage) MStorage {
+	for {
+		w, ok := m.(interface{ Unwrap() MStorage })
+		if !ok {
+			return m
+		}
+		m = w.Unwrap()
+	}
+}
+
+// GaugeStorage saves the gauge and publishes it
+func (p *Publisher) GaugeStorage(c context.Context, k string, v float64) error {
+	if err := p.MStorage.GaugeStorage(c, k, v); err != nil {
+		return err
+	}
+	if p.stream.Active() {
+		id, labels := ParseMetricKey(k)
+		p.stream.Publish(Metrics{ID: id, MType: config.Gauge, Value: &v, Labels: labels})
+	}
+	return nil
+}
+
+// CountStorage adds to the counter and publishes its total
+func (p *Publisher) CountStorage(c context.Context, k string, v int64) error {
+	if err := p.MStorage.CountStorage(c, k, v); err != nil {
+		return err
+	}
+	if p.stream.Active() {
+		p.publish(c, []Metrics{{ID: k, MType: config.Counter}})
+	}
+	return nil
+}
+
+// HistogramStorage merges the histogram and publishes the result
+func (p *Publisher) HistogramStorage(c context.Context, k string, h Histogram) error {
+	if err := p.MStorage.HistogramStorage(c, k, h); err != nil {
+		return err
+	}
+	if p.stream.Active() {
+		p.publish(c, []Metrics{{ID: k, MType: config.Histogram}})
+	}
+	return nil
+}
+
+// UpdateBatch saves the list and publishes the updated series
+func (p *Publisher) UpdateBatch(c context.Context, list []Metrics) error {
+	if err := p.MStorage.UpdateBatch(c, list); err != nil {
+		return err
+	}
+	if p.stream.Active() {
+		p.publish(c, list)
+	}
+	return nil
+}
+
+// UpdateFromSource saves the counters reported by the source and publishes the updated series
+func (p *Publisher) UpdateFromSource(c context.Context, source string, list []Metrics) error {
+	if err := p.MStorage.UpdateFromSource(c, source, list); err != nil {
+		return err
+	}
+	if p.stream.Active() {
+		p.publish(c, list)
+	}
+	return nil
+}
+
+// publish reads the current values of the updated counters and histograms and sends the list to the stream.
+// The update is already saved, a series that can not be read back is not published.
+func (p *Publisher) publish(c context.Context, list []Metrics) {
+	res := make([]Metrics, 0, len(list))
+	for _, metric := range list {
+		key := metric.Key()
+		id, labels := ParseMetricKey(key)
+		updated := Metrics{ID: id, MType: metric.MType, Labels: labels}
+		switch metric.MType {
+		case config.Gauge:
+			updated.Value = metric.Value
+		case config.Counter:
+			delta, err := p.MStorage.GetCount(c, key)
+			if err != nil {
+				continue
+			}
+			updated.Delta = &delta
+		case config.Histogram:
+			h, err := p.MStorage.GetHistogram(c, key)
+			if err != nil {
+				continue
+			}
+			updated.Histogram = &h
+		default:
+			continue
+		}
+		res = append(res, updated)
+	}
+	p.stream.Publish(res...)
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPublisher(t *testing.T) {
+	ctx := context.Background()
+	ms := &MemStorage{}
+	stream := NewStream()
+	p := NewPublisher(ms, stream)
+	assert.Equal(t, MStorage(ms), Unwrap(p))
+	assert.Equal(t, MStorage(ms), Unwrap(ms))
+
+	// без подписчиков обновления не публикуются
+	assert.NoError(t, p.CountStorage(ctx, "PollCount", 1))
+
+	sub := stream.Subscribe(nil)
+	defer stream.Unsubscribe(sub)
+	assert.NoError(t, p.CountStorage(ctx, "PollCount", 2))
+	assert.NoError(t, p.GaugeStorage(ctx, `Alloc{host="web1"}`, 5))
+	assert.NoError(t, p.HistogramStorage(ctx, "latency", NewHistogram([]float64{1})))
+	delta := int64(4)
+	assert.NoError(t, p.UpdateBatch(ctx, []Metrics{{ID: "PollCount", MType: config.Counter, Delta: &delta}}))
+
+	list := sub.Next()
+	if assert.Len(t, list, 3) {
+		assert.Equal(t, int64(7), *list[0].Delta, "Expected the total of the counter")
+		assert.Equal(t, "Alloc", list[1].ID)
+		assert.Equal(t, map[string]string{"host": "web1"}, list[1].Labels)
+		assert.Equal(t, 5.0, *list[1].Value)
+		assert.NotNil(t, list[2].Histogram)
+	}
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"path"
+	"time"
+)
+
+// Silence mutes alerts for metrics matching the pattern during the time range
+type Silence struct {
+	ID        string    `json:"id"`
+	Matcher   string    `json:"matcher"` // шаблон имени метрики, например Heap*
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+// Active reports whether the silence is in effect at the moment
+func (s Silence) Active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// Matches reports whether the metric name matches the silence pattern
+func (s Silence) Matches(metric string) bool {
+	ok, err := path.Match(s.Matcher, metric)
+	return err == nil && ok
+}
+
+// MatchesSeries reports whether the pattern matches the name of the series or its whole key,
+// so Heap* mutes all series of HeapAlloc and load{host="web1"} mutes only one of them
+func (s Silence) MatchesSeries(key string) bool {
+	if s.Matches(key) {
+		return true
+	}
+	id, _ := ParseMetricKey(key)
+	return id != key && s.Matches(id)
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSilence_Active(t *testing.T) {
+	now := time.Now()
+	s := Silence{StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Minute)}
+	assert.True(t, s.Active(now))
+	assert.False(t, s.Active(now.Add(2*time.Minute)))
+	assert.False(t, s.Active(now.Add(-2*time.Minute)))
+}
+
+func TestSilence_Matches(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher string
+		metric  string
+		want    bool
+	}{
+		{name: "exact", matcher: "PollCount", metric: "PollCount", want: true},
+		{name: "glob", matcher: "Heap*", metric: "HeapAlloc", want: true},
+		{name: "no match", matcher: "Heap*", metric: "PollCount", want: false},
+		{name: "bad pattern", matcher: "[", metric: "PollCount", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Silence{Matcher: tt.matcher}
+			assert.Equal(t, tt.want, s.Matches(tt.metric))
+		})
+	}
+}
+
+func TestSilence_MatchesSeries(t *testing.T) {
+	assert.True(t, Silence{Matcher: "load"}.MatchesSeries(`load{host="web1"}`))
+	assert.True(t, Silence{Matcher: `load{host="web1"}`}.MatchesSeries(`load{host="web1"}`))
+	assert.False(t, Silence{Matcher: `load{host="web1"}`}.MatchesSeries(`load{host="web2"}`))
+	assert.True(t, Silence{Matcher: "Heap*"}.MatchesSeries("HeapAlloc"))
+}
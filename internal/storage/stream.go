@@ -0,0 +1,158 @@
+package storage
+
+import "sync"
+
+// StreamMaxPending is the number of series a subscriber may fall behind by before it is dropped
+const StreamMaxPending = 10000
+
+// Stream delivers the updated series to the subscribers.
+// A slow subscriber does not block the updates: the pending updates of a series are merged
+// and the subscriber gets only the latest value. A subscriber with more than StreamMaxPending
+// pending series is dropped, see Subscription.Overflowed.
+type Stream struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription is the feed of one subscriber
+type Subscription struct {
+	filter func(Metrics) bool
+
+	mu         sync.Mutex
+	pending    map[string]Metrics // последние значения по seriesKey, еще не прочитанные
+	order      []string
+	overflowed bool
+
+	ready chan struct{}
+	done  chan struct{}
+}
+
+// NewStream returns a stream without subscribers
+func NewStream() *Stream {
+	return &Stream{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe adds a subscriber that gets the series accepted by the filter, nil filter accepts all series.
+// The subscription is done at once when the stream is closed.
+func (s *Stream) Subscribe(filter func(Metrics) bool) *Subscription {
+	sub := &Subscription{
+		filter:  filter,
+		pending: make(map[string]Metrics),
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		close(sub.done)
+		return sub
+	}
+	s.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes the subscriber, it is safe to call it several times
+func (s *Stream) Unsubscribe(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[sub]; ok {
+		delete(s.subs, sub)
+		close(sub.done)
+	}
+}
+
+// Active reports whether the stream has subscribers, the publishers skip preparing the updates otherwise
+func (s *Stream) Active() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs) > 0
+}
+
+// Publish sends the updated series to the subscribers, it never waits for them
+func (s *Stream) Publish(list ...Metrics) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		if !sub.push(list) {
+			delete(s.subs, sub)
+			close(sub.done)
+		}
+	}
+}
+
+// Close ends all subscriptions, the later subscriptions are done at once
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		close(sub.done)
+	}
+	s.subs = make(map[*Subscription]struct{})
+	s.closed = true
+}
+
+// push adds the accepted series to the pending ones, false means the subscriber fell behind too far
+func (sub *Subscription) push(list []Metrics) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	added := false
+	for _, metric := range list {
+		if sub.filter != nil && !sub.filter(metric) {
+			continue
+		}
+		key := seriesKey(metric.MType, metric.Key())
+		if _, ok := sub.pending[key]; !ok {
+			if len(sub.order) >= StreamMaxPending {
+				sub.overflowed = true
+				return false
+			}
+			sub.order = append(sub.order, key)
+		}
+		sub.pending[key] = metric
+		added = true
+	}
+	if added {
+		select {
+		case sub.ready <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// Ready is signalled when the subscription has pending series
+func (sub *Subscription) Ready() <-chan struct{} {
+	return sub.ready
+}
+
+// Done is closed when the subscription ends
+func (sub *Subscription) Done() <-chan struct{} {
+	return sub.done
+}
+
+// Next returns the pending series in the order of their first update since the previous call
+func (sub *Subscription) Next() []Metrics {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	res := make([]Metrics, 0, len(sub.order))
+	for _, key := range sub.order {
+		res = append(res, sub.pending[key])
+	}
+	sub.pending = make(map[string]Metrics)
+	sub.order = nil
+	return res
+}
+
+// Overflowed reports whether the subscription was dropped because the subscriber fell behind
+func (sub *Subscription) Overflowed() bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.overflowed
+}
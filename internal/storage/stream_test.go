@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func gaugeMetric(id string, v float64) Metrics {
+	return Metrics{ID: id, MType: config.Gauge, Value: &v}
+}
+
+func TestStream(t *testing.T) {
+	stream := NewStream()
+	assert.False(t, stream.Active())
+	all := stream.Subscribe(nil)
+	heap := stream.Subscribe(func(m Metrics) bool {
+		return m.ID == "HeapAlloc"
+	})
+	assert.True(t, stream.Active())
+
+	stream.Publish(gaugeMetric("Alloc", 1), gaugeMetric("HeapAlloc", 2))
+	stream.Publish(gaugeMetric("Alloc", 3))
+	select {
+	case <-all.Ready():
+	default:
+		t.Fatal("Expected the subscription to be ready")
+	}
+	list := all.Next()
+	if assert.Len(t, list, 2, "Expected the updates of a series to be merged") {
+		assert.Equal(t, "Alloc", list[0].ID)
+		assert.Equal(t, 3.0, *list[0].Value)
+		assert.Equal(t, "HeapAlloc", list[1].ID)
+	}
+	assert.Empty(t, all.Next())
+	list = heap.Next()
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "HeapAlloc", list[0].ID)
+	}
+
+	stream.Unsubscribe(heap)
+	stream.Unsubscribe(heap)
+	<-heap.Done()
+	stream.Close()
+	<-all.Done()
+	assert.False(t, all.Overflowed())
+	assert.False(t, stream.Active())
+	<-stream.Subscribe(nil).Done()
+}
+
+func TestStreamOverflow(t *testing.T) {
+	stream := NewStream()
+	sub := stream.Subscribe(nil)
+	for i := 0; i < StreamMaxPending; i++ {
+		stream.Publish(gaugeMetric("Alloc", float64(i)))
+	}
+	assert.True(t, stream.Active(), "Expected the updates of a series to be merged")
+	for i := 0; i < StreamMaxPending; i++ {
+		stream.Publish(gaugeMetric("Alloc"+strconv.Itoa(i), 1))
+	}
+	<-sub.Done()
+	assert.True(t, sub.Overflowed())
+	assert.False(t, stream.Active())
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"github.com/Nchezhegova/metrics-alerts/internal/config"
+	"sort"
+	"strings"
+)
+
+// ListValues returns all gauges and counters of the storage
+func ListValues(c context.Context, m MStorage) (map[string]float64, map[string]int64, error) {
+	res, err := m.GetStorage(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	gauges := make(map[string]float64, len(res.Gauge))
+	for name, value := range res.Gauge {
+		gauges[name] = value
+	}
+	counters := make(map[string]int64, len(res.Counter))
+	for name, value := range res.Counter {
+		counters[name] = value
+	}
+	return gauges, counters, nil
+}
+
+// ListMetrics returns all gauges, counters and histograms of the storage as []Metrics sorted by name
+func ListMetrics(c context.Context, m MStorage) ([]Metrics, error) {
+	res, err := m.GetStorage(c)
+	if err != nil {
+		return nil, err
+	}
+	return res.Metrics(), nil
+}
+
+// Metrics returns the gauges, counters and histograms of the snapshot sorted by name, labels and type
+func (s Snapshot) Metrics() []Metrics {
+	res := make([]Metrics, 0, len(s.Gauge)+len(s.Counter)+len(s.Histograms))
+	for key, v := range s.Gauge {
+		id, labels := ParseMetricKey(key)
+		value := v
+		res = append(res, Metrics{ID: id, MType: config.Gauge, Value: &value, Labels: labels})
+	}
+	for key, v := range s.Counter {
+		id, labels := ParseMetricKey(key)
+		delta := v
+		res = append(res, Metrics{ID: id, MType: config.Counter, Delta: &delta, Labels: labels})
+	}
+	for key, v := range s.Histograms {
+		id, labels := ParseMetricKey(key)
+		h := v
+		res = append(res, Metrics{ID: id, MType: config.Histogram, Histogram: &h, Labels: labels})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return CompareByName(res[i], res[j]) < 0
+	})
+	return res
+}
+
+// CompareByName orders the metrics by name, then by labels and type
+func CompareByName(a Metrics, b Metrics) int {
+	if c := strings.Compare(a.ID, b.ID); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Key(), b.Key()); c != 0 {
+		return c
+	}
+	return strings.Compare(a.MType, b.MType)
+}
+
+// ListHistograms returns all histograms of the storage
+func ListHistograms(c context.Context, m MStorage) (map[string]Histogram, error) {
+	res, err := m.GetStorage(c)
+	if err != nil {
+		return nil, err
+	}
+	histograms := make(map[string]Histogram, len(res.Histograms))
+	for key, h := range res.Histograms {
+		histograms[key] = h
+	}
+	return histograms, nil
+}
+
+// Select returns the gauges and counters of the series that satisfy all matchers
+func Select(c context.Context, m MStorage, matchers []Matcher) (map[string]float64, map[string]int64, error) {
+	gauges, counters, err := ListValues(c, m)
+	if err != nil {
+		return nil, nil, err
+	}
+	return matchKeys(gauges, matchers), matchKeys(counters, matchers), nil
+}
+
+// SelectHistograms returns the histograms of the series that satisfy all matchers
+func SelectHistograms(c context.Context, m MStorage, matchers []Matcher) (map[string]Histogram, error) {
+	histograms, err := ListHistograms(c, m)
+	if err != nil {
+		return nil, err
+	}
+	return matchKeys(histograms, matchers), nil
+}
+
+// matchKeys removes the series that do not satisfy the matchers from the map
+func matchKeys[V any](values map[string]V, matchers []Matcher) map[string]V {
+	for key := range values {
+		if id, labels := ParseMetricKey(key); !MatchSeries(matchers, id, labels) {
+			delete(values, key)
+		}
+	}
+	return values
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestListValues(t *testing.T) {
+	data := Snapshot{
+		Gauge:   map[string]float64{"HeapAlloc": 36.6},
+		Counter: map[string]int64{"PollCount": 54},
+	}
+	storage := NewMemStorage(data)
+	gauges, counters, err := ListValues(context.Background(), storage)
+	assert.NoError(t, err)
+	assert.Equal(t, data.Gauge, gauges)
+	assert.Equal(t, data.Counter, counters)
+
+	gauges["HeapAlloc"] = 1
+	v, err := storage.GetGauge(context.Background(), "HeapAlloc")
+	assert.NoError(t, err)
+	assert.Equal(t, 36.6, v, "Expected a copy of the storage maps")
+}
+
+func TestSelect(t *testing.T) {
+	storage := NewMemStorage(Snapshot{
+		Gauge:   map[string]float64{`load{host="web1"}`: 1, `load{host="web2"}`: 2, "HeapAlloc": 36.6},
+		Counter: map[string]int64{`requests{host="web1"}`: 7},
+	})
+	host, err := ParseMatcher("host=web1")
+	assert.NoError(t, err)
+	gauges, counters, err := Select(context.Background(), storage, []Matcher{host})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{`load{host="web1"}`: 1}, gauges)
+	assert.Equal(t, map[string]int64{`requests{host="web1"}`: 7}, counters)
+
+	gauges, _, err = Select(context.Background(), storage, nil)
+	assert.NoError(t, err)
+	assert.Len(t, gauges, 3)
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// WAL is an append-only log of metric updates.
+// Every line is one batch, it is synced to disk before the batch is applied to the storage.
+type WAL struct {
+	mu   sync.Mutex
+	file *os.File
+	seq  uint64
+}
+
+// walBatch is one line of the WAL, Seq grows with every batch and survives compaction
+type walBatch struct {
+	Seq     uint64      `json:"seq"`
+	Records []walRecord `json:"records"`
+}
+
+// Ops of the records that are not series updates
+const (
+	// walDelete removes the series
+	walDelete = "delete"
+	// walSilence adds or replaces the silence, Key is its id
+	walSilence = "silence"
+	// walUnsilence removes the silence with the id in Key
+	walUnsilence = "unsilence"
+)
+
+// walRecord is one update or removal of a series or a silence
+type walRecord struct {
+	Op        string     `json:"op,omitempty"`
+	Key       string     `json:"key"`
+	MType     string     `json:"type"`
+	Delta     int64      `json:"delta,omitempty"`
+	Value     float64    `json:"value,omitempty"`
+	Histogram *Histogram `json:"histogram,omitempty"`
+	Silence   *Silence   `json:"silence,omitempty"`
+	// Source reported the counter as the cumulative value Reported, Delta is its increase
+	Source   string `json:"source,omitempty"`
+	Reported int64  `json:"reported,omitempty"`
+}
+
+// OpenWAL opens or creates the WAL file
+func OpenWAL(path string) (*WAL, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &WAL{file: file}, nil
+}
+
+// Close closes the WAL file
+func (w *WAL) Close() error {
+	return w.file.Close()
+}
+
+// append writes the batch and waits until it is on disk, it returns the batch sequence number
+func (w *WAL) append(records []walRecord) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data, err := json.Marshal(walBatch{Seq: w.seq + 1, Records: records})
+	if err != nil {
+		return 0, err
+	}
+	if _, err = w.file.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	if err = w.file.Sync(); err != nil {
+		return 0, err
+	}
+	w.seq++
+	return w.seq, nil
+}
+
+// replay calls apply for every batch after the sequence number.
+// An unfinished last line left by a crash is cut off, a broken line in the middle is an error.
+func (w *WAL) replay(after uint64, apply func(walBatch)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.seq = after
+	reader := bufio.NewReader(w.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				return w.file.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var batch walBatch
+		if err = json.Unmarshal(line, &batch); err != nil {
+			return fmt.Errorf("broken WAL batch at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+		if batch.Seq > w.seq {
+			w.seq = batch.Seq
+		}
+		if batch.Seq > after {
+			apply(batch)
+		}
+	}
+}
+
+// lastSeq returns the sequence number of the last batch
+func (w *WAL) lastSeq() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq
+}
+
+// truncate drops all batches, the sequence numbers continue
+func (w *WAL) truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Truncate(0)
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestWAL(t *testing.T, path string) *MemStorage {
+	wal, err := OpenWAL(path)
+	assert.NoError(t, err)
+	t.Cleanup(func() { wal.Close() })
+	return &MemStorage{WAL: wal}
+}
+
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	ctx := context.Background()
+
+	m := openTestWAL(t, path)
+	assert.NoError(t, m.GaugeStorage(ctx, "Alloc", 1.5))
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 2))
+	d := int64(3)
+	v := 2.5
+	err := m.UpdateBatch(ctx, []Metrics{
+		{ID: "PollCount", MType: "counter", Delta: &d},
+		{ID: "Alloc", MType: "gauge", Value: &v},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), m.Snapshot().WALSeq)
+
+	// сервер упал, новая память восстанавливается из WAL
+	restored := openTestWAL(t, path)
+	assert.NoError(t, restored.Replay())
+	snapshot := restored.Snapshot()
+	assert.Equal(t, map[string]float64{"Alloc": 2.5}, snapshot.Gauge)
+	assert.Equal(t, map[string]int64{"PollCount": 5}, snapshot.Counter)
+	assert.Equal(t, uint64(3), snapshot.WALSeq)
+
+	assert.NoError(t, restored.CountStorage(ctx, "PollCount", 1))
+	assert.Equal(t, uint64(4), restored.Snapshot().WALSeq)
+}
+
+func TestWALReplaySkipsSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	ctx := context.Background()
+
+	m := openTestWAL(t, path)
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 2))
+	snapshot := m.Snapshot()
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 3))
+
+	restored := openTestWAL(t, path)
+	restored.SetStartData(snapshot)
+	assert.NoError(t, restored.Replay())
+	assert.Equal(t, int64(5), restored.Snapshot().Counter["PollCount"])
+}
+
+func TestWALTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	ctx := context.Background()
+
+	m := openTestWAL(t, path)
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 2))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"seq":2,"records":[{"key"`)
+	assert.NoError(t, err)
+	file.Close()
+
+	restored := openTestWAL(t, path)
+	assert.NoError(t, restored.Replay())
+	assert.Equal(t, int64(2), restored.Snapshot().Counter["PollCount"])
+	assert.NoError(t, restored.CountStorage(ctx, "PollCount", 1))
+
+	again := openTestWAL(t, path)
+	assert.NoError(t, again.Replay())
+	assert.Equal(t, int64(3), again.Snapshot().Counter["PollCount"])
+}
+
+func TestWALBrokenLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	assert.NoError(t, os.WriteFile(path, []byte("garbage\n{\"seq\":1,\"records\":[]}\n"), 0600))
+
+	m := openTestWAL(t, path)
+	assert.Error(t, m.Replay())
+}
+
+func TestWALTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	ctx := context.Background()
+
+	m := openTestWAL(t, path)
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 2))
+	assert.NoError(t, m.TruncateWAL())
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 3))
+	assert.Equal(t, uint64(2), m.Snapshot().WALSeq)
+
+	restored := openTestWAL(t, path)
+	assert.NoError(t, restored.Replay())
+	assert.Equal(t, int64(3), restored.Snapshot().Counter["PollCount"])
+	assert.Equal(t, uint64(2), restored.Snapshot().WALSeq)
+}
+
+func TestWALCompactConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	ctx := context.Background()
+
+	m := openTestWAL(t, path)
+	var saved Snapshot
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				assert.NoError(t, m.CountStorage(ctx, "PollCount", 1))
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, m.Compact(func(data Snapshot) error {
+			saved = data
+			return nil
+		}))
+	}
+	wg.Wait()
+
+	restored := openTestWAL(t, path)
+	restored.SetStartData(saved)
+	assert.NoError(t, restored.Replay())
+	assert.Equal(t, int64(200), restored.Snapshot().Counter["PollCount"])
+}
+
+func TestWALReplayDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	ctx := context.Background()
+
+	m := openTestWAL(t, path)
+	assert.NoError(t, m.GaugeStorage(ctx, "Alloc", 1.5))
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 2))
+	deleted, err := m.DeleteMetrics(ctx, []Metrics{{ID: "Alloc", MType: "gauge"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	deleted, err = m.Expire(ctx, time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.NoError(t, m.CountStorage(ctx, "PollCount", 1))
+
+	restored := openTestWAL(t, path)
+	assert.NoError(t, restored.Replay())
+	snapshot := restored.Snapshot()
+	assert.Empty(t, snapshot.Gauge)
+	assert.Equal(t, map[string]int64{"PollCount": 1}, snapshot.Counter)
+	assert.Equal(t, m.Snapshot().WALSeq, snapshot.WALSeq)
+}
+
+func TestWALReplaySilences(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := openTestWAL(t, path)
+	assert.NoError(t, m.AddSilence(ctx, Silence{ID: "1", Matcher: "Heap*", StartsAt: start, EndsAt: start.Add(time.Hour)}))
+	assert.NoError(t, m.AddSilence(ctx, Silence{ID: "2", Matcher: "Poll*", StartsAt: start, EndsAt: start.Add(time.Hour)}))
+	deleted, err := m.DeleteSilence(ctx, "1")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = m.DeleteSilence(ctx, "1")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+	assert.Equal(t, uint64(3), m.Snapshot().WALSeq)
+
+	restored := openTestWAL(t, path)
+	assert.NoError(t, restored.Replay())
+	silences, err := restored.GetSilences(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, silences, 1) {
+		assert.Equal(t, "Poll*", silences[0].Matcher)
+	}
+}